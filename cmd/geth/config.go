@@ -22,7 +22,10 @@ import (
 	"fmt"
 	"math/big"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
 	"unicode"
 
 	"github.com/urfave/cli/v2"
@@ -41,6 +44,7 @@ import (
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/plugins"
 	"github.com/naoina/toml"
 )
 
@@ -50,7 +54,7 @@ var (
 		Name:        "dumpconfig",
 		Usage:       "Show configuration values",
 		ArgsUsage:   "",
-		Flags:       flags.Merge(nodeFlags, rpcFlags),
+		Flags:       flags.Merge(nodeFlags, rpcFlags, pluginsFlags),
 		Description: `The dumpconfig command shows configuration values.`,
 	}
 
@@ -92,6 +96,7 @@ type gethConfig struct {
 	Node     node.Config
 	Ethstats ethstatsConfig
 	Metrics  metrics.Config
+	Plugins  plugins.Config
 }
 
 func loadConfig(file string, cfg *gethConfig) error {
@@ -119,8 +124,9 @@ func defaultNodeConfig() node.Config {
 	return cfg
 }
 
-// makeConfigNode loads geth configuration and creates a blank node instance.
-func makeConfigNode(ctx *cli.Context) (*node.Node, gethConfig) {
+// loadBaseConfig loads the defaults and the configuration file, without
+// applying any flags.
+func loadBaseConfig(ctx *cli.Context) gethConfig {
 	// Load defaults.
 	cfg := gethConfig{
 		Eth:     ethconfig.Defaults,
@@ -134,6 +140,21 @@ func makeConfigNode(ctx *cli.Context) (*node.Node, gethConfig) {
 			utils.Fatalf("%v", err)
 		}
 	}
+	return cfg
+}
+
+// makePluginsConfig returns the plugin loader settings. Plugins are loaded
+// before the node is created, so this only loads the parts of the
+// configuration it needs.
+func makePluginsConfig(ctx *cli.Context) plugins.Config {
+	cfg := loadBaseConfig(ctx)
+	applyPluginsConfig(ctx, &cfg)
+	return cfg.Plugins
+}
+
+// makeConfigNode loads geth configuration and creates a blank node instance.
+func makeConfigNode(ctx *cli.Context) (*node.Node, gethConfig) {
+	cfg := loadBaseConfig(ctx)
 
 	// Apply flags.
 	utils.SetNodeConfig(ctx, &cfg.Node)
@@ -151,6 +172,7 @@ func makeConfigNode(ctx *cli.Context) (*node.Node, gethConfig) {
 		cfg.Ethstats.URL = ctx.String(utils.EthStatsURLFlag.Name)
 	}
 	applyMetricConfig(ctx, &cfg)
+	applyPluginsConfig(ctx, &cfg)
 
 	return stack, cfg
 }
@@ -268,6 +290,71 @@ func applyMetricConfig(ctx *cli.Context, cfg *gethConfig) {
 	}
 }
 
+func applyPluginsConfig(ctx *cli.Context, cfg *gethConfig) {
+	if ctx.IsSet(utils.PluginsDirFlag.Name) {
+		cfg.Plugins.Dir = ctx.String(utils.PluginsDirFlag.Name)
+	}
+	if cfg.Plugins.Dir == "" {
+		dataDir := cfg.Node.DataDir
+		if ctx.IsSet(utils.DataDirFlag.Name) {
+			dataDir = ctx.String(utils.DataDirFlag.Name)
+		}
+		cfg.Plugins.Dir = filepath.Join(dataDir, "plugins")
+	}
+	if ctx.IsSet(utils.PluginsEnableFlag.Name) {
+		cfg.Plugins.Enable = utils.SplitAndTrim(ctx.String(utils.PluginsEnableFlag.Name))
+	}
+	if ctx.IsSet(utils.PluginsDisableFlag.Name) {
+		cfg.Plugins.Disable = utils.SplitAndTrim(ctx.String(utils.PluginsDisableFlag.Name))
+	}
+	if ctx.IsSet(utils.PluginsOrderFlag.Name) {
+		cfg.Plugins.Order = utils.SplitAndTrim(ctx.String(utils.PluginsOrderFlag.Name))
+	}
+	if ctx.IsSet(utils.PluginsMaxFaultsFlag.Name) {
+		cfg.Plugins.MaxFaults = ctx.Uint64(utils.PluginsMaxFaultsFlag.Name)
+	}
+	if ctx.IsSet(utils.PluginsSlowHookFlag.Name) {
+		cfg.Plugins.SlowHookThreshold = ctx.Duration(utils.PluginsSlowHookFlag.Name)
+	}
+	if ctx.IsSet(utils.PluginsRemoteTimeoutFlag.Name) {
+		cfg.Plugins.RemoteTimeout = ctx.Duration(utils.PluginsRemoteTimeoutFlag.Name)
+	}
+	if ctx.IsSet(utils.PluginsAsyncFlag.Name) {
+		for _, spec := range utils.SplitAndTrim(ctx.String(utils.PluginsAsyncFlag.Name)) {
+			name, async, err := parsePluginsAsync(spec, cfg.Plugins.Async)
+			if err != nil {
+				utils.Fatalf("Invalid --%s: %v", utils.PluginsAsyncFlag.Name, err)
+			}
+			if cfg.Plugins.Async == nil {
+				cfg.Plugins.Async = make(map[string]plugins.AsyncConfig)
+			}
+			cfg.Plugins.Async[name] = async
+		}
+	}
+}
+
+// parsePluginsAsync parses the asynchronous delivery settings of a plugin given
+// as name[:policy[:queuesize]], the hooks delivered asynchronously being kept
+// from the configuration file.
+func parsePluginsAsync(spec string, configured map[string]plugins.AsyncConfig) (string, plugins.AsyncConfig, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) > 3 || parts[0] == "" {
+		return "", plugins.AsyncConfig{}, fmt.Errorf("invalid setting %q, want name[:policy[:queuesize]]", spec)
+	}
+	name, async := parts[0], configured[parts[0]]
+	if len(parts) > 1 {
+		async.Policy = parts[1]
+	}
+	if len(parts) > 2 {
+		size, err := strconv.Atoi(parts[2])
+		if err != nil {
+			return "", plugins.AsyncConfig{}, fmt.Errorf("invalid queue size %q of plugin %v", parts[2], name)
+		}
+		async.QueueSize = size
+	}
+	return name, async, nil
+}
+
 func deprecated(field string) bool {
 	switch field {
 	case "ethconfig.Config.EVMInterpreter":
@@ -20,7 +20,6 @@ package main
 import (
 	"fmt"
 	"os"
-	"path"
 	"sort"
 	"strconv"
 	"strings"
@@ -205,6 +204,17 @@ var (
 		utils.MetricsInfluxDBBucketFlag,
 		utils.MetricsInfluxDBOrganizationFlag,
 	}
+
+	pluginsFlags = []cli.Flag{
+		utils.PluginsDirFlag,
+		utils.PluginsEnableFlag,
+		utils.PluginsDisableFlag,
+		utils.PluginsOrderFlag,
+		utils.PluginsMaxFaultsFlag,
+		utils.PluginsSlowHookFlag,
+		utils.PluginsRemoteTimeoutFlag,
+		utils.PluginsAsyncFlag,
+	}
 )
 
 func init() {
@@ -243,6 +253,8 @@ func init() {
 		utils.ShowDeprecated,
 		// See snapshot.go
 		snapshotCommand,
+		// See pluginscmd.go
+		pluginsCommand,
 	}
 	sort.Sort(cli.CommandsByName(app.Commands))
 
@@ -252,6 +264,7 @@ func init() {
 		consoleFlags,
 		debug.Flags,
 		metricsFlags,
+		pluginsFlags,
 	)
 
 	app.Before = func(ctx *cli.Context) error {
@@ -345,7 +358,7 @@ func prepare(ctx *cli.Context) {
 // blocking mode, waiting for it to be shut down.
 func geth(ctx *cli.Context) error {
 	//begin PluGeth code injection
-	if err := plugins.Initialize(path.Join(ctx.String(utils.DataDirFlag.Name), "plugins"), ctx); err != nil {
+	if err := plugins.Initialize(makePluginsConfig(ctx), ctx); err != nil {
 		return err
 	}
 	prepare(ctx)
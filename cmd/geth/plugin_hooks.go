@@ -1,6 +1,8 @@
 package main
 
 import (
+	"sync"
+
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/plugins"
@@ -23,7 +25,8 @@ func apiTranslate(apis []core.API) []rpc.API {
 	return result
 }
 
-func GetAPIsFromLoader(pl *plugins.PluginLoader, stack *node.Node, backend restricted.Backend) []rpc.API {
+// pluginAPIs invokes the GetAPIs hook of the plugins of pl.
+func pluginAPIs(pl *plugins.PluginLoader, stack *node.Node, backend restricted.Backend) []rpc.API {
 	result := []core.API{}
 	fnList := pl.Lookup("GetAPIs", func(item interface{}) bool {
 		switch item.(type) {
@@ -47,6 +50,106 @@ func GetAPIsFromLoader(pl *plugins.PluginLoader, stack *node.Node, backend restr
 	return apiTranslate(result)
 }
 
+func GetAPIsFromLoader(pl *plugins.PluginLoader, stack *node.Node, backend restricted.Backend) []rpc.API {
+	admin := &pluginAdminAPI{
+		pl:      pl,
+		stack:   stack,
+		backend: backend,
+		apis:    make(map[string][]rpc.API),
+	}
+	result := []rpc.API{}
+	for _, plugin := range pl.Split() {
+		apis := pluginAPIs(plugin, stack, backend)
+		admin.apis[pluginFile(plugin)] = apis
+		result = append(result, apis...)
+	}
+	return append(result, rpc.API{
+		Namespace: "plugeth",
+		Version:   "1.0",
+		Service:   plugins.NewAPI(pl),
+		Public:    true,
+	}, rpc.API{
+		Namespace: "admin",
+		Version:   "1.0",
+		Service:   admin,
+	})
+}
+
+// pluginFile returns the file of the single plugin of pl.
+func pluginFile(pl *plugins.PluginLoader) string {
+	return pl.PluginInfo()[0].File
+}
+
+// pluginAdminAPI loads and reloads plugins while the node is running, under
+// the admin namespace.
+type pluginAdminAPI struct {
+	pl      *plugins.PluginLoader
+	stack   *node.Node
+	backend restricted.Backend
+
+	lock sync.Mutex
+	apis map[string][]rpc.API // provided by each plugin, keyed by file
+}
+
+// ReloadPlugins restarts the plugins running in their own process and loads
+// plugins added to the plugins directory, returning the loaded plugins.
+func (api *pluginAdminAPI) ReloadPlugins() ([]plugins.PluginInfo, error) {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	added, removed, err := api.pl.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return api.pl.PluginInfo(), api.apply(added, removed)
+}
+
+// LoadPlugin loads a plugin file, replacing any loaded plugin of the same
+// name, and returns the loaded plugins. Relative paths are resolved against
+// the plugins directory.
+func (api *pluginAdminAPI) LoadPlugin(path string) ([]plugins.PluginInfo, error) {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+
+	added, removed, err := api.pl.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return api.pl.PluginInfo(), api.apply(added, removed)
+}
+
+// apply initializes added plugins and registers their APIs, then unregisters
+// the APIs of removed plugins and shuts them down.
+func (api *pluginAdminAPI) apply(added, removed *plugins.PluginLoader) error {
+	InitializeNode(added, api.stack, api.backend)
+	var old, apis []rpc.API
+	for _, plugin := range added.Split() {
+		provided := pluginAPIs(plugin, api.stack, api.backend)
+		old = append(old, api.apis[pluginFile(plugin)]...)
+		api.apis[pluginFile(plugin)] = provided
+		apis = append(apis, provided...)
+	}
+	for _, plugin := range removed.Split() {
+		if _, ok := api.apis[pluginFile(plugin)]; ok && !providedBy(added, pluginFile(plugin)) {
+			old = append(old, api.apis[pluginFile(plugin)]...)
+			delete(api.apis, pluginFile(plugin))
+		}
+	}
+	err := api.stack.ReplaceAPIs(old, apis)
+	OnShutdown(removed)
+	return err
+}
+
+// providedBy reports whether pl holds the plugin loaded from file.
+func providedBy(pl *plugins.PluginLoader, file string) bool {
+	for _, info := range pl.PluginInfo() {
+		if info.File == file {
+			return true
+		}
+	}
+	return false
+}
+
 func pluginGetAPIs(stack *node.Node, backend restricted.Backend) []rpc.API {
 	if plugins.DefaultPluginLoader == nil {
 		log.Warn("Attempting GetAPIs, but default PluginLoader has not been initialized")
@@ -86,6 +189,7 @@ func pluginsInitializeNode(stack *node.Node, backend restricted.Backend) {
 }
 
 func OnShutdown(pl *plugins.PluginLoader) {
+	pl.Drain()
 	fnList := pl.Lookup("OnShutdown", func(item interface{}) bool {
 		_, ok := item.(func())
 		return ok
@@ -93,6 +197,7 @@ func OnShutdown(pl *plugins.PluginLoader) {
 	for _, fni := range fnList {
 		fni.(func())()
 	}
+	pl.Close()
 }
 
 func pluginsOnShutdown() {
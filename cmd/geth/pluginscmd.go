@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/flags"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/plugins"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	replayFromFlag = &cli.Uint64Flag{
+		Name:  "from",
+		Usage: "First block to replay",
+	}
+	replayToFlag = &cli.Uint64Flag{
+		Name:  "to",
+		Usage: "Last block to replay (default = head block)",
+	}
+	replayHooksFlag = &cli.StringFlag{
+		Name:  "hooks",
+		Usage: "Comma separated hooks to replay (" + strings.Join(replayHooks, ", ") + ")",
+		Value: "StateUpdate,NewHead",
+	}
+	replayCheckpointFlag = &cli.StringFlag{
+		Name:  "checkpoint",
+		Usage: "File recording the progress of the replay, resumed if interrupted (default = plugin-replay.json in the instance directory)",
+	}
+
+	pluginsCommand = &cli.Command{
+		Name:  "plugins",
+		Usage: "Plugin management commands",
+		Subcommands: []*cli.Command{
+			{
+				Action:    pluginsReplay,
+				Name:      "replay",
+				Usage:     "Replay the hooks of historical blocks to the loaded plugins",
+				ArgsUsage: "",
+				Flags: flags.Merge([]cli.Flag{
+					replayFromFlag,
+					replayToFlag,
+					replayHooksFlag,
+					replayCheckpointFlag,
+					utils.CacheFlag,
+					utils.SyncModeFlag,
+					utils.GCModeFlag,
+				}, utils.DatabasePathFlags, pluginsFlags),
+				Description: `
+The replay command fires the selected hooks of the loaded plugins for the blocks
+of the given range, in order, as if the plugins had been installed when the
+blocks were imported. Plugins are initialized, but InitializeNode is not invoked.
+
+StateUpdate and StateDiff re-execute each block on the state of its parent, which
+must be available (use an archive node for old blocks), and deliver the
+allocation of the genesis block as changes to the empty state. NewHead reads the
+block, its logs and total difficulty from the database. ModifyAncients and
+FreezerBatch read the items of frozen blocks back from the freezer, decoded as
+when the blocks are imported, and skip blocks not frozen yet.
+
+Progress is checkpointed, so an interrupted replay of the same hooks and range
+resumes where it stopped when started again.`,
+			},
+		},
+	}
+)
+
+// replayHooks are the hooks the replay command can fire, in the order they are
+// fired for each block.
+var replayHooks = []string{"StateUpdate", "StateDiff", "NewHead", "ModifyAncients", "FreezerBatch"}
+
+// replayCheckpoint records the progress of a replay.
+type replayCheckpoint struct {
+	Hooks []string `json:"hooks"`
+	From  uint64   `json:"from"`
+	To    uint64   `json:"to"`
+	Next  uint64   `json:"next"`
+}
+
+func (c *replayCheckpoint) matches(other *replayCheckpoint) bool {
+	return strings.Join(c.Hooks, ",") == strings.Join(other.Hooks, ",") && c.From == other.From && c.To == other.To
+}
+
+func readReplayCheckpoint(path string) (*replayCheckpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	checkpoint := new(replayCheckpoint)
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid replay checkpoint %v: %v", path, err)
+	}
+	return checkpoint, nil
+}
+
+func writeReplayCheckpoint(path string, checkpoint *replayCheckpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, so an interruption cannot corrupt it
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// parseReplayHooks validates the comma separated list of hooks to replay and
+// returns them in firing order.
+func parseReplayHooks(list string) ([]string, error) {
+	selected := make(map[string]bool)
+	for _, hook := range strings.Split(list, ",") {
+		if hook = strings.TrimSpace(hook); hook == "" {
+			continue
+		}
+		valid := false
+		for _, h := range replayHooks {
+			valid = valid || h == hook
+		}
+		if !valid {
+			return nil, fmt.Errorf("hook %v cannot be replayed, supported hooks are %v", hook, strings.Join(replayHooks, ", "))
+		}
+		selected[hook] = true
+	}
+	var hooks []string
+	for _, hook := range replayHooks {
+		if selected[hook] {
+			hooks = append(hooks, hook)
+		}
+	}
+	if len(hooks) == 0 {
+		return nil, errors.New("no hooks to replay")
+	}
+	return hooks, nil
+}
+
+func pluginsReplay(ctx *cli.Context) error {
+	hooks, err := parseReplayHooks(ctx.String(replayHooksFlag.Name))
+	if err != nil {
+		return err
+	}
+	if err := plugins.Initialize(makePluginsConfig(ctx), ctx); err != nil {
+		return err
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, db := utils.MakeChain(ctx, stack)
+	defer db.Close()
+	defer chain.Stop()
+
+	from, to := ctx.Uint64(replayFromFlag.Name), chain.CurrentBlock().NumberU64()
+	if ctx.IsSet(replayToFlag.Name) {
+		if to = ctx.Uint64(replayToFlag.Name); to > chain.CurrentBlock().NumberU64() {
+			return fmt.Errorf("block %d is beyond the head block %d", to, chain.CurrentBlock().NumberU64())
+		}
+	}
+	if from > to {
+		return fmt.Errorf("invalid range %d-%d", from, to)
+	}
+	path := stack.ResolvePath("plugin-replay.json")
+	if ctx.IsSet(replayCheckpointFlag.Name) {
+		path = ctx.String(replayCheckpointFlag.Name)
+	}
+	checkpoint := &replayCheckpoint{Hooks: hooks, From: from, To: to, Next: from}
+	if previous, err := readReplayCheckpoint(path); err != nil {
+		return err
+	} else if previous != nil && previous.matches(checkpoint) {
+		log.Info("Resuming interrupted replay", "checkpoint", path, "next", previous.Next)
+		checkpoint.Next = previous.Next
+	}
+	// Hooks fired by the node code, such as StateUpdate, are looked up through
+	// the default loader, which only provides the replayed hooks meanwhile.
+	loader := plugins.DefaultPluginLoader
+	defer func() {
+		plugins.DefaultPluginLoader = loader
+		pluginsOnShutdown()
+	}()
+	plugins.DefaultPluginLoader = loader.Restrict(hooks...)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	var (
+		start  = time.Now()
+		logged = time.Now()
+	)
+	log.Info("Replaying plugin hooks", "hooks", strings.Join(hooks, ","), "from", checkpoint.Next, "to", to)
+	for ; checkpoint.Next <= to; checkpoint.Next++ {
+		select {
+		case <-interrupt:
+			log.Info("Replay interrupted", "next", checkpoint.Next)
+			return writeReplayCheckpoint(path, checkpoint)
+		default:
+		}
+		if err := replayBlock(chain, db, plugins.DefaultPluginLoader, hooks, checkpoint.Next); err != nil {
+			if cerr := writeReplayCheckpoint(path, checkpoint); cerr != nil {
+				log.Error("Failed to write replay checkpoint", "err", cerr)
+			}
+			return fmt.Errorf("failed to replay block %d: %v", checkpoint.Next, err)
+		}
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Replaying plugin hooks", "number", checkpoint.Next, "to", to, "elapsed", common.PrettyDuration(time.Since(start)))
+			if err := writeReplayCheckpoint(path, checkpoint); err != nil {
+				return err
+			}
+			logged = time.Now()
+		}
+	}
+	log.Info("Replayed plugin hooks", "blocks", to-from+1, "elapsed", common.PrettyDuration(time.Since(start)))
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// replayGenesisState fires StateUpdate and StateDiff for the allocation of the
+// genesis block, as changes to the empty state. Databases of legacy nodes do not
+// hold the allocation, the genesis block is then skipped.
+func replayGenesisState(db ethdb.Database, genesis *types.Block) error {
+	blob := rawdb.ReadGenesisState(db, genesis.Hash())
+	if len(blob) == 0 {
+		log.Warn("Genesis allocation not stored, skipping state hooks of genesis block")
+		return nil
+	}
+	var alloc core.GenesisAlloc
+	if err := alloc.UnmarshalJSON(blob); err != nil {
+		return err
+	}
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	if err != nil {
+		return err
+	}
+	for addr, account := range alloc {
+		statedb.AddBalance(addr, account.Balance)
+		statedb.SetCode(addr, account.Code)
+		statedb.SetNonce(addr, account.Nonce)
+		for key, value := range account.Storage {
+			statedb.SetState(addr, key, value)
+		}
+	}
+	// Commit fires StateUpdate and StateDiff
+	root, err := statedb.Commit(false)
+	if err != nil {
+		return err
+	}
+	if root != genesis.Root() {
+		return fmt.Errorf("genesis state root mismatch: have %x, want %x", root, genesis.Root())
+	}
+	return nil
+}
+
+// replayBlock fires the given hooks for the canonical block of number.
+func replayBlock(chain *core.BlockChain, db ethdb.Database, pl *plugins.PluginLoader, hooks []string, number uint64) error {
+	block := chain.GetBlockByNumber(number)
+	if block == nil {
+		return errors.New("block not found")
+	}
+	selected := make(map[string]bool)
+	for _, hook := range hooks {
+		selected[hook] = true
+	}
+	var logs []*types.Log
+	if (selected["StateUpdate"] || selected["StateDiff"]) && number == 0 {
+		if err := replayGenesisState(db, block); err != nil {
+			return err
+		}
+	} else if selected["StateUpdate"] || selected["StateDiff"] {
+		parent := chain.GetHeader(block.ParentHash(), number-1)
+		if parent == nil {
+			return errors.New("parent not found")
+		}
+		// A fresh state database per block keeps the trie nodes committed
+		// by the replay from accumulating in memory.
+		statedb, err := state.New(parent.Root, state.NewDatabase(db), nil)
+		if err != nil {
+			return fmt.Errorf("state of block %d unavailable: %v", number-1, err)
+		}
+		receipts, _, _, err := chain.Processor().Process(block, statedb, vm.Config{})
+		if err != nil {
+			return err
+		}
+		// Commit fires StateUpdate and StateDiff
+		root, err := statedb.Commit(chain.Config().IsEIP158(block.Number()))
+		if err != nil {
+			return err
+		}
+		if root != block.Root() {
+			return fmt.Errorf("state root mismatch: have %x, want %x", root, block.Root())
+		}
+		for _, receipt := range receipts {
+			logs = append(logs, receipt.Logs...)
+		}
+	} else {
+		for _, txLogs := range rawdb.ReadLogs(db, block.Hash(), number, chain.Config()) {
+			logs = append(logs, txLogs...)
+		}
+	}
+	if selected["NewHead"] {
+		core.PluginNewHead(pl, block, block.Hash(), logs, chain.GetTd(block.Hash(), number))
+	}
+	if selected["ModifyAncients"] || selected["FreezerBatch"] {
+		if frozen, err := db.Ancients(); err == nil && number < frozen {
+			if err := rawdb.PluginReplayAncients(pl, db, number); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -970,6 +970,49 @@ var (
 		Value:    metrics.DefaultConfig.InfluxDBOrganization,
 		Category: flags.MetricsCategory,
 	}
+
+	// Plugin settings
+	PluginsDirFlag = &cli.StringFlag{
+		Name:     "plugins.dir",
+		Usage:    "Directory to load plugins from (default = inside the datadir)",
+		Category: flags.PluginsCategory,
+	}
+	PluginsEnableFlag = &cli.StringFlag{
+		Name:     "plugins.enable",
+		Usage:    "Comma separated list of plugins to load (default = all plugins in the plugins directory)",
+		Category: flags.PluginsCategory,
+	}
+	PluginsDisableFlag = &cli.StringFlag{
+		Name:     "plugins.disable",
+		Usage:    "Comma separated list of plugins not to load",
+		Category: flags.PluginsCategory,
+	}
+	PluginsOrderFlag = &cli.StringFlag{
+		Name:     "plugins.order",
+		Usage:    "Comma separated list of plugins, in the order hooks are dispatched to them (overrides the plugins.order file)",
+		Category: flags.PluginsCategory,
+	}
+	PluginsMaxFaultsFlag = &cli.Uint64Flag{
+		Name:     "plugins.maxfaults",
+		Usage:    "Number of panicking hook invocations after which a plugin is quarantined (0 = never)",
+		Category: flags.PluginsCategory,
+	}
+	PluginsSlowHookFlag = &cli.DurationFlag{
+		Name:     "plugins.slowhook",
+		Usage:    "Log a warning for plugin hook invocations taking longer than this (0 = never)",
+		Category: flags.PluginsCategory,
+	}
+	PluginsRemoteTimeoutFlag = &cli.DurationFlag{
+		Name:     "plugins.remotetimeout",
+		Usage:    "Time plugins running in their own process get to answer a call, hook invocations timing out count as faults",
+		Value:    10 * time.Second,
+		Category: flags.PluginsCategory,
+	}
+	PluginsAsyncFlag = &cli.StringFlag{
+		Name:     "plugins.async",
+		Usage:    "Comma separated list of plugins whose hooks are delivered asynchronously, as name[:policy[:queuesize]] (policies: block, drop-oldest, halt)",
+		Category: flags.PluginsCategory,
+	}
 )
 
 var (
@@ -297,3 +297,110 @@ func pluginGetBlockTracer(hash common.Hash, statedb *state.StateDB) (*metaTracer
 	}
 	return PluginGetBlockTracer(plugins.DefaultPluginLoader, hash, statedb)
 }
+
+// Reasons passed to the PoolTransactionDropped hook.
+const (
+	poolDropExpired       = "expired"        // queued for longer than the configured lifetime
+	poolDropUnderpriced   = "underpriced"    // below the minimum price, or evicted by a better priced transaction
+	poolDropReplaceFailed = "replace-failed" // a pending transaction with the same nonce is priced higher
+	poolDropNonceTooLow   = "nonce-too-low"  // included in a block, or superseded by one
+	poolDropUnpayable     = "unpayable"      // insufficient balance, or above the block gas limit
+	poolDropAccountLimit  = "account-limit"  // too many queued transactions of the sender
+	poolDropPendingLimit  = "pending-limit"  // evicted by truncatePending
+	poolDropQueueLimit    = "queue-limit"    // evicted by truncateQueue
+)
+
+// The transaction pool hooks are invoked with the pool lock held, plugins
+// must not call back into the pool from them.
+
+func PluginValidatePoolTransaction(pl *plugins.PluginLoader, tx *types.Transaction, local bool) error {
+	fnList := pl.Lookup("ValidatePoolTransaction", func(item interface{}) bool {
+		_, ok := item.(func([]byte, bool) error)
+		return ok
+	})
+	if len(fnList) == 0 {
+		return nil
+	}
+	txBytes, _ := tx.MarshalBinary()
+	for _, fni := range fnList {
+		if fn, ok := fni.(func([]byte, bool) error); ok {
+			if err := fn(txBytes, local); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+func pluginValidatePoolTransaction(tx *types.Transaction, local bool) error {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting ValidatePoolTransaction, but default PluginLoader has not been initialized")
+		return nil
+	}
+	return PluginValidatePoolTransaction(plugins.DefaultPluginLoader, tx, local)
+}
+
+func PluginPoolTransactionAdded(pl *plugins.PluginLoader, tx *types.Transaction, local bool) {
+	fnList := pl.Lookup("PoolTransactionAdded", func(item interface{}) bool {
+		_, ok := item.(func([]byte, bool))
+		return ok
+	})
+	if len(fnList) == 0 {
+		return
+	}
+	txBytes, _ := tx.MarshalBinary()
+	for _, fni := range fnList {
+		if fn, ok := fni.(func([]byte, bool)); ok {
+			fn(txBytes, local)
+		}
+	}
+}
+func pluginPoolTransactionAdded(tx *types.Transaction, local bool) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting PoolTransactionAdded, but default PluginLoader has not been initialized")
+		return
+	}
+	PluginPoolTransactionAdded(plugins.DefaultPluginLoader, tx, local)
+}
+
+func PluginPoolTransactionDropped(pl *plugins.PluginLoader, txs types.Transactions, reason string) {
+	fnList := pl.Lookup("PoolTransactionDropped", func(item interface{}) bool {
+		_, ok := item.(func(core.Hash, string))
+		return ok
+	})
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(core.Hash, string)); ok {
+			for _, tx := range txs {
+				fn(core.Hash(tx.Hash()), reason)
+			}
+		}
+	}
+}
+func pluginPoolTransactionDropped(txs types.Transactions, reason string) {
+	if len(txs) == 0 {
+		return
+	}
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting PoolTransactionDropped, but default PluginLoader has not been initialized")
+		return
+	}
+	PluginPoolTransactionDropped(plugins.DefaultPluginLoader, txs, reason)
+}
+
+func PluginPoolTransactionReplaced(pl *plugins.PluginLoader, old, tx *types.Transaction) {
+	fnList := pl.Lookup("PoolTransactionReplaced", func(item interface{}) bool {
+		_, ok := item.(func(core.Hash, core.Hash))
+		return ok
+	})
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(core.Hash, core.Hash)); ok {
+			fn(core.Hash(old.Hash()), core.Hash(tx.Hash()))
+		}
+	}
+}
+func pluginPoolTransactionReplaced(old, tx *types.Transaction) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting PoolTransactionReplaced, but default PluginLoader has not been initialized")
+		return
+	}
+	PluginPoolTransactionReplaced(plugins.DefaultPluginLoader, old, tx)
+}
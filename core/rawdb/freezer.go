@@ -264,7 +264,7 @@ func (f *Freezer) ModifyAncients(fn func(ethdb.AncientWriteOp) error) (writeSize
 		return 0, err
 	}
 	//begin PluGeth code injection
-	pluginCommitUpdate(item)
+	pluginFreezerUpdates(f.writeBatch.updates)
 	//end PluGeth code injection
 	atomic.StoreUint64(&f.frozen, item)
 	return writeSize, nil
@@ -287,6 +287,9 @@ func (f *Freezer) TruncateHead(items uint64) error {
 		}
 	}
 	atomic.StoreUint64(&f.frozen, items)
+	//begin PluGeth code injection
+	pluginFreezerTruncateHead(items)
+	//end PluGeth code injection
 	return nil
 }
 
@@ -307,6 +310,9 @@ func (f *Freezer) TruncateTail(tail uint64) error {
 		}
 	}
 	atomic.StoreUint64(&f.tail, tail)
+	//begin PluGeth code injection
+	pluginFreezerTruncateTail(tail)
+	//end PluGeth code injection
 	return nil
 }
 
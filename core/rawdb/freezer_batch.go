@@ -32,6 +32,9 @@ const freezerBatchBufferLimit = 2 * 1024 * 1024
 // freezerBatch is a write operation of multiple items on a freezer.
 type freezerBatch struct {
 	tables map[string]*freezerTableBatch
+
+	tracking bool             // whether plugins receive the appended items
+	updates  []*FreezerUpdate // appended items, by block, for plugins
 }
 
 func newFreezerBatch(f *Freezer) *freezerBatch {
@@ -44,14 +47,21 @@ func newFreezerBatch(f *Freezer) *freezerBatch {
 
 // Append adds an RLP-encoded item of the given kind.
 func (batch *freezerBatch) Append(kind string, num uint64, item interface{}) error {
-	PluginTrackUpdate(num, kind, item)
-	return batch.tables[kind].Append(num, item)
+	tb := batch.tables[kind]
+	if err := tb.Append(num, item); err != nil {
+		return err
+	}
+	batch.track(kind, num, item, tb.encBuffer.data)
+	return nil
 }
 
 // AppendRaw adds an item of the given kind.
 func (batch *freezerBatch) AppendRaw(kind string, num uint64, item []byte) error {
-	PluginTrackUpdate(num, kind, item)
-	return batch.tables[kind].AppendRaw(num, item)
+	if err := batch.tables[kind].AppendRaw(num, item); err != nil {
+		return err
+	}
+	batch.track(kind, num, item, item)
+	return nil
 }
 
 // reset initializes the batch.
@@ -59,6 +69,8 @@ func (batch *freezerBatch) reset() {
 	for _, tb := range batch.tables {
 		tb.reset()
 	}
+	batch.tracking = pluginTracksAncients()
+	batch.updates = nil
 }
 
 // commit is called at the end of a write operation and
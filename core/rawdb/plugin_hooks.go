@@ -1,120 +1,234 @@
 package rawdb
 
-
 import (
-	"github.com/ethereum/go-ethereum/plugins"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/plugins"
+	"github.com/ethereum/go-ethereum/plugins/freezer"
 	"github.com/ethereum/go-ethereum/rlp"
-	"sync"
+	"github.com/openrelayxyz/plugeth-utils/core"
 )
 
-var (
-	freezerUpdates map[uint64]map[string]interface{}
-	lock sync.Mutex
-)
-
-func PluginTrackUpdate(num uint64, kind string, value interface{}) {
-	lock.Lock()
-	defer lock.Unlock()
-	if freezerUpdates == nil { freezerUpdates = make(map[uint64]map[string]interface{}) }
-	update, ok := freezerUpdates[num]
-	if !ok {
-		update = make(map[string]interface{})
-		freezerUpdates[num] = update
-	}
-	update[kind] = value
+// FreezerUpdate holds the items of a block written to the freezer by table, as
+// given to the freezer and as stored, RLP encoded but for the raw hashes.
+type FreezerUpdate struct {
+	Number  uint64
+	Values  map[string]interface{}
+	Encoded map[string][]byte
 }
 
-func pluginCommitUpdate(num uint64) {
-	if plugins.DefaultPluginLoader == nil {
-		log.Warn("Attempting CommitUpdate, but default PluginLoader has not been initialized")
+// track records an item appended to the batch, if plugins receive the blocks
+// written to the freezer. Items of a batch are appended in ascending order, as
+// the tables reject any other.
+func (batch *freezerBatch) track(kind string, num uint64, value interface{}, encoded []byte) {
+	if !batch.tracking {
 		return
 	}
-	PluginCommitUpdate(plugins.DefaultPluginLoader, num)
+	if len(batch.updates) == 0 || batch.updates[len(batch.updates)-1].Number != num {
+		batch.updates = append(batch.updates, &FreezerUpdate{
+			Number:  num,
+			Values:  make(map[string]interface{}),
+			Encoded: make(map[string][]byte),
+		})
+	}
+	update := batch.updates[len(batch.updates)-1]
+	update.Values[kind] = value
+	update.Encoded[kind] = common.CopyBytes(encoded)
 }
 
-func PluginCommitUpdate(pl *plugins.PluginLoader, num uint64) {
-	lock.Lock()
-	defer lock.Unlock()
-	if freezerUpdates == nil { freezerUpdates = make(map[uint64]map[string]interface{}) }
-	min := ^uint64(0)
-	for i := range freezerUpdates{
-		if min > i { min = i }
-	}
-	for i := min ; i < num; i++ {
-		update, ok := freezerUpdates[i]
-		defer func(i uint64) { delete(freezerUpdates, i) }(i)
-		if !ok {
-			log.Warn("Attempting to commit untracked block", "num", i)
-			continue
+// PluginTracksAncients reports whether plugins receive the blocks written to the
+// freezer.
+func PluginTracksAncients(pl *plugins.PluginLoader) bool {
+	for _, name := range []string{"ModifyAncients", "AppendAncient", "FreezerBatch"} {
+		if len(pl.Lookup(name, func(interface{}) bool { return true })) > 0 {
+			return true
 		}
-		fnList := pl.Lookup("ModifyAncients", func(item interface{}) bool {
-			_, ok := item.(func(uint64, map[string]interface{}))
-			return ok
-		})
+	}
+	return false
+}
+
+func pluginTracksAncients() bool {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting TracksAncients, but default PluginLoader has not been initialized")
+		return false
+	}
+	return PluginTracksAncients(plugins.DefaultPluginLoader)
+}
+
+// PluginFreezerUpdates delivers the blocks of a freezer write operation, in
+// ascending order, once the operation is committed. ModifyAncients and the
+// deprecated AppendAncient receive each block. FreezerBatch receives all of
+// them at once, see freezer.Block.
+func PluginFreezerUpdates(pl *plugins.PluginLoader, updates []*FreezerUpdate) {
+	if len(updates) == 0 {
+		return
+	}
+	fnList := pl.Lookup("ModifyAncients", func(item interface{}) bool {
+		_, ok := item.(func(uint64, map[string]interface{}))
+		return ok
+	})
+	appendAncientFnList := pl.Lookup("AppendAncient", func(item interface{}) bool {
+		_, ok := item.(func(number uint64, hash, header, body, receipts, td []byte))
+		return ok
+	})
+	if len(appendAncientFnList) > 0 {
+		log.Warn("PlugEth's AppendAncient is deprecated. Please update to ModifyAncients or FreezerBatch.")
+	}
+	for _, update := range updates {
 		for _, fni := range fnList {
 			if fn, ok := fni.(func(uint64, map[string]interface{})); ok {
-				fn(i, update)
+				fn(update.Number, update.Values)
 			}
 		}
-		appendAncientFnList := pl.Lookup("AppendAncient", func(item interface{}) bool {
-			_, ok := item.(func(number uint64, hash, header, body, receipts, td []byte))
-			if ok { log.Warn("PlugEth's AppendAncient is deprecated. Please update to ModifyAncients.") }
-			return ok
-		})
-		if len(appendAncientFnList) > 0 {
-			var (
-				hash []byte
-				header []byte
-				body []byte
-				receipts []byte
-				td []byte
-			)
-			if hashi, ok := update[freezerHashTable]; ok {
-				switch v := hashi.(type) {
-				case []byte:
-					hash = v
-				default:
-					hash, _ = rlp.EncodeToBytes(v)
-				}
+		for _, fni := range appendAncientFnList {
+			if fn, ok := fni.(func(number uint64, hash, header, body, receipts, td []byte)); ok {
+				e := update.Encoded
+				fn(update.Number, e[freezerHashTable], e[freezerHeaderTable], e[freezerBodiesTable], e[freezerReceiptTable], e[freezerDifficultyTable])
 			}
-			if headeri, ok := update[freezerHeaderTable]; ok {
-				switch v := headeri.(type) {
-				case []byte:
-					header = v
-				default:
-					header, _ = rlp.EncodeToBytes(v)
-				}
-			}
-			if bodyi, ok := update[freezerBodiesTable]; ok {
-				switch v := bodyi.(type) {
-				case []byte:
-					body = v
-				default:
-					body, _ = rlp.EncodeToBytes(v)
-				}
-			}
-			if receiptsi, ok := update[freezerReceiptTable]; ok {
-				switch v := receiptsi.(type) {
-				case []byte:
-					receipts = v
-				default:
-					receipts, _ = rlp.EncodeToBytes(v)
-				}
-			}
-			if tdi, ok := update[freezerDifficultyTable]; ok {
-				switch v := tdi.(type) {
-				case []byte:
-					td = v
-				default:
-					td, _ = rlp.EncodeToBytes(v)
-				}
+		}
+	}
+	batchFnList := pl.Lookup("FreezerBatch", func(item interface{}) bool {
+		_, ok := item.(func([]*freezer.Block))
+		return ok
+	})
+	if len(batchFnList) == 0 {
+		return
+	}
+	blocks := make([]*freezer.Block, len(updates))
+	for i, update := range updates {
+		blocks[i] = newFreezerBlock(update)
+	}
+	for _, fni := range batchFnList {
+		if fn, ok := fni.(func([]*freezer.Block)); ok {
+			fn(blocks)
+		}
+	}
+}
+
+// newFreezerBlock converts the items of a block written to the freezer for
+// plugins. The values given to the freezer are not used, as writers reuse them
+// across blocks.
+func newFreezerBlock(update *FreezerUpdate) *freezer.Block {
+	e := update.Encoded
+	block := &freezer.Block{
+		Number:   update.Number,
+		Header:   e[freezerHeaderTable],
+		Body:     e[freezerBodiesTable],
+		Receipts: e[freezerReceiptTable],
+	}
+	if hash, ok := e[freezerHashTable]; ok {
+		block.Hash = core.BytesToHash(hash)
+	}
+	if data, ok := e[freezerDifficultyTable]; ok {
+		td := new(big.Int)
+		if err := rlp.DecodeBytes(data, td); err != nil {
+			log.Warn("Failed to decode total difficulty for plugins", "number", update.Number, "err", err)
+		} else {
+			block.Td = td
+		}
+	}
+	return block
+}
+
+func pluginFreezerUpdates(updates []*FreezerUpdate) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting FreezerUpdates, but default PluginLoader has not been initialized")
+		return
+	}
+	PluginFreezerUpdates(plugins.DefaultPluginLoader, updates)
+}
+
+// PluginFreezerTruncateHead signals the items of the freezer from items onwards
+// were discarded, such as by a rewind of the chain. Blocks written to the
+// freezer afterwards are delivered from number items.
+func PluginFreezerTruncateHead(pl *plugins.PluginLoader, items uint64) {
+	fnList := pl.Lookup("FreezerTruncateHead", func(item interface{}) bool {
+		_, ok := item.(func(uint64))
+		return ok
+	})
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(uint64)); ok {
+			fn(items)
+		}
+	}
+}
+
+func pluginFreezerTruncateHead(items uint64) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting FreezerTruncateHead, but default PluginLoader has not been initialized")
+		return
+	}
+	PluginFreezerTruncateHead(plugins.DefaultPluginLoader, items)
+}
+
+// PluginFreezerTruncateTail signals the items of the freezer below tail were
+// discarded.
+func PluginFreezerTruncateTail(pl *plugins.PluginLoader, tail uint64) {
+	fnList := pl.Lookup("FreezerTruncateTail", func(item interface{}) bool {
+		_, ok := item.(func(uint64))
+		return ok
+	})
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(uint64)); ok {
+			fn(tail)
+		}
+	}
+}
+
+func pluginFreezerTruncateTail(tail uint64) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting FreezerTruncateTail, but default PluginLoader has not been initialized")
+		return
+	}
+	PluginFreezerTruncateTail(plugins.DefaultPluginLoader, tail)
+}
+
+// PluginReplayAncients delivers the items of a frozen block to plugins again,
+// read back from the freezer and decoded to the values WriteAncientBlocks
+// gives the freezer as blocks are imported: the raw hash, the *types.Header,
+// *types.Body, []*types.ReceiptForStorage and the *big.Int total difficulty.
+func PluginReplayAncients(pl *plugins.PluginLoader, db ethdb.AncientReader, number uint64) error {
+	update := &FreezerUpdate{
+		Number:  number,
+		Values:  make(map[string]interface{}),
+		Encoded: make(map[string][]byte),
+	}
+	for kind := range FreezerNoSnappy {
+		data, err := db.Ancient(kind, number)
+		if err != nil {
+			return err
+		}
+		var value interface{}
+		switch kind {
+		case freezerHashTable:
+			value = data
+		case freezerHeaderTable:
+			value = new(types.Header)
+		case freezerBodiesTable:
+			value = new(types.Body)
+		case freezerReceiptTable:
+			value = new([]*types.ReceiptForStorage)
+		case freezerDifficultyTable:
+			value = new(big.Int)
+		default:
+			value = data
+		}
+		if _, raw := value.([]byte); !raw {
+			if err := rlp.DecodeBytes(data, value); err != nil {
+				return fmt.Errorf("invalid %v of frozen block %d: %v", kind, number, err)
 			}
-			for _, fni := range appendAncientFnList {
-				if fn, ok := fni.(func(number uint64, hash, header, body, receipts, td []byte)); ok {
-					fn(i, hash, header, body, receipts, td)
-				}
+			if receipts, ok := value.(*[]*types.ReceiptForStorage); ok {
+				value = *receipts
 			}
 		}
+		update.Values[kind] = value
+		update.Encoded[kind] = data
 	}
+	PluginFreezerUpdates(pl, []*FreezerUpdate{update})
+	return nil
 }
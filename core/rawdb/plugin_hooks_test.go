@@ -0,0 +1,127 @@
+package rawdb
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/plugins"
+	"github.com/ethereum/go-ethereum/plugins/freezer"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+func TestFreezerHooks(t *testing.T) {
+	var (
+		blocks   = makeTestBlocks(6, 1)
+		receipts = make([]types.Receipts, len(blocks))
+		events   []string
+		frozen   []*freezer.Block
+		modified []uint64
+		values   []map[string]interface{}
+	)
+	for i, block := range blocks {
+		header := block.Header()
+		header.Difficulty = big.NewInt(1)
+		blocks[i] = block.WithSeal(header)
+		receipts[i] = types.Receipts{{
+			Status:            types.ReceiptStatusSuccessful,
+			CumulativeGasUsed: uint64(i),
+			Logs:              []*types.Log{{Address: common.Address{byte(i)}}},
+		}}
+	}
+	old := plugins.DefaultPluginLoader
+	plugins.DefaultPluginLoader = &plugins.PluginLoader{
+		LookupCache: map[string][]interface{}{
+			"FreezerBatch": {func(blocks []*freezer.Block) {
+				events = append(events, fmt.Sprintf("batch %d-%d", blocks[0].Number, blocks[len(blocks)-1].Number))
+				frozen = append(frozen, blocks...)
+			}},
+			"ModifyAncients": {func(number uint64, update map[string]interface{}) {
+				modified = append(modified, number)
+				values = append(values, update)
+			}},
+			"FreezerTruncateHead": {func(items uint64) {
+				events = append(events, fmt.Sprintf("head %d", items))
+			}},
+			"FreezerTruncateTail": {func(tail uint64) {
+				events = append(events, fmt.Sprintf("tail %d", tail))
+			}},
+		},
+	}
+	defer func() { plugins.DefaultPluginLoader = old }()
+
+	f, err := NewFreezer(t.TempDir(), "", false, 2049, FreezerNoSnappy)
+	if err != nil {
+		t.Fatalf("Failed to open freezer: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := WriteAncientBlocks(f, blocks[:3], receipts[:3], big.NewInt(1)); err != nil {
+		t.Fatalf("Failed to write blocks: %v", err)
+	}
+	if _, err := WriteAncientBlocks(f, blocks[3:], receipts[3:], big.NewInt(4)); err != nil {
+		t.Fatalf("Failed to write blocks: %v", err)
+	}
+	// Failed write operations are rolled back, and not delivered.
+	if _, err := f.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+		op.AppendRaw(freezerHashTable, 6, common.Hash{}.Bytes())
+		return errors.New("failed")
+	}); err == nil {
+		t.Fatalf("Expected the write operation to fail")
+	}
+	if err := f.TruncateHead(4); err != nil {
+		t.Fatalf("Failed to truncate head: %v", err)
+	}
+	if _, err := WriteAncientBlocks(f, blocks[4:5], receipts[4:5], big.NewInt(5)); err != nil {
+		t.Fatalf("Failed to write blocks: %v", err)
+	}
+	if err := f.TruncateTail(2); err != nil {
+		t.Fatalf("Failed to truncate tail: %v", err)
+	}
+
+	want := []string{"batch 0-2", "batch 3-5", "head 4", "batch 4-4", "tail 2"}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("Unexpected events %v, want %v", events, want)
+	}
+	if fmt.Sprint(modified) != fmt.Sprint([]uint64{0, 1, 2, 3, 4, 5, 4}) {
+		t.Errorf("Unexpected ModifyAncients blocks %v", modified)
+	}
+	for i, block := range frozen {
+		original := blocks[block.Number]
+		var header types.Header
+		if block.Hash != core.Hash(original.Hash()) || rlp.DecodeBytes(block.Header, &header) != nil || header.Hash() != original.Hash() {
+			t.Errorf("block %d: unexpected hash or header", i)
+		}
+		var body types.Body
+		if err := rlp.DecodeBytes(block.Body, &body); err != nil || len(body.Transactions) != 1 || body.Transactions[0].Hash() != original.Transactions()[0].Hash() {
+			t.Errorf("block %d: unexpected body", i)
+		}
+		var stored []*types.ReceiptForStorage
+		if err := rlp.DecodeBytes(block.Receipts, &stored); err != nil || len(stored) != 1 || stored[0].Logs[0].Address != (common.Address{byte(block.Number)}) {
+			t.Errorf("block %d: unexpected receipts", i)
+		}
+		if block.Td == nil || block.Td.Uint64() != block.Number+1 {
+			t.Errorf("block %d: unexpected total difficulty %v", i, block.Td)
+		}
+	}
+
+	// Replayed blocks are delivered with the values of imported ones
+	live := values[3]
+	if err := PluginReplayAncients(plugins.DefaultPluginLoader, f, 3); err != nil {
+		t.Fatalf("Failed to replay block: %v", err)
+	}
+	replayed := values[len(values)-1]
+	for kind, value := range live {
+		if fmt.Sprintf("%T", replayed[kind]) != fmt.Sprintf("%T", value) {
+			t.Errorf("Replayed %v is a %T, want %T", kind, replayed[kind], value)
+		}
+	}
+	if header, ok := replayed[freezerHeaderTable].(*types.Header); !ok || header.Hash() != blocks[3].Hash() {
+		t.Errorf("Unexpected replayed header %v", replayed[freezerHeaderTable])
+	}
+}
@@ -1,32 +1,114 @@
 package state
 
 import (
-	"fmt"
+	"errors"
+	"math/big"
+
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/plugins"
-	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/plugins/statediff"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/openrelayxyz/plugeth-utils/core"
 )
 
+// pluginSnapshot serves flat state reads from plugins when the snapshot tree is
+// unavailable, and feeds the state updates of committed blocks to plugins.
 type pluginSnapshot struct {
 	root common.Hash
 }
 
+var errSnapshotNotImplemented = errors.New("not implemented")
+
 func (s *pluginSnapshot) Root() common.Hash {
 	return s.root
 }
 
 func (s *pluginSnapshot) Account(hash common.Hash) (*snapshot.Account, error) {
-	return nil, fmt.Errorf("not implemented")
+	data, err := s.AccountRLP(hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 { // can be both nil and []byte{}
+		return nil, nil
+	}
+	account := new(snapshot.Account)
+	if err := rlp.DecodeBytes(data, account); err != nil {
+		return nil, err
+	}
+	return account, nil
 }
 
 func (s *pluginSnapshot) AccountRLP(hash common.Hash) ([]byte, error) {
-	return nil, fmt.Errorf("not implemented")
+	return pluginGetSnapshotAccount(s.root, hash)
 }
 
 func (s *pluginSnapshot) Storage(accountHash, storageHash common.Hash) ([]byte, error) {
-	return nil, fmt.Errorf("not implemented")
+	return pluginGetSnapshotStorage(s.root, accountHash, storageHash)
+}
+
+// PluginGetSnapshotAccount retrieves the slim RLP encoded account of the given
+// hash in the state of root from plugins, as found in the accounts of
+// StateUpdate. A nil result means the account does not exist. The first plugin
+// returning no error answers; if none does, the account is read from the trie.
+// Faulty plugins do not answer (see LookupFallible).
+func PluginGetSnapshotAccount(pl *plugins.PluginLoader, root, hash common.Hash) ([]byte, error) {
+	fnList := pl.LookupFallible("GetSnapshotAccount", func(item interface{}) bool {
+		_, ok := item.(func(core.Hash, core.Hash) ([]byte, error))
+		return ok
+	})
+	err := errSnapshotNotImplemented
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(core.Hash, core.Hash) ([]byte, error)); ok {
+			var data []byte
+			if data, err = fn(core.Hash(root), core.Hash(hash)); err == nil {
+				return data, nil
+			}
+		}
+	}
+	return nil, err
+}
+
+// pluginGetSnapshotAccount is invoked for every account read, so a missing
+// loader is not reported.
+func pluginGetSnapshotAccount(root, hash common.Hash) ([]byte, error) {
+	if plugins.DefaultPluginLoader == nil {
+		return nil, errSnapshotNotImplemented
+	}
+	return PluginGetSnapshotAccount(plugins.DefaultPluginLoader, root, hash)
+}
+
+// PluginGetSnapshotStorage retrieves the RLP encoded storage slot of the given
+// hashes in the state of root from plugins, as found in the storage of
+// StateUpdate. A nil result means the slot is empty. The first plugin
+// returning no error answers; if none does, the slot is read from the trie.
+// Faulty plugins do not answer (see LookupFallible).
+func PluginGetSnapshotStorage(pl *plugins.PluginLoader, root, accountHash, storageHash common.Hash) ([]byte, error) {
+	fnList := pl.LookupFallible("GetSnapshotStorage", func(item interface{}) bool {
+		_, ok := item.(func(core.Hash, core.Hash, core.Hash) ([]byte, error))
+		return ok
+	})
+	err := errSnapshotNotImplemented
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(core.Hash, core.Hash, core.Hash) ([]byte, error)); ok {
+			var data []byte
+			if data, err = fn(core.Hash(root), core.Hash(accountHash), core.Hash(storageHash)); err == nil {
+				return data, nil
+			}
+		}
+	}
+	return nil, err
+}
+
+// pluginGetSnapshotStorage is invoked for every storage read, so a missing
+// loader is not reported.
+func pluginGetSnapshotStorage(root, accountHash, storageHash common.Hash) ([]byte, error) {
+	if plugins.DefaultPluginLoader == nil {
+		return nil, errSnapshotNotImplemented
+	}
+	return PluginGetSnapshotStorage(plugins.DefaultPluginLoader, root, accountHash, storageHash)
 }
 
 func PluginStateUpdate(pl *plugins.PluginLoader, blockRoot, parentRoot common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte, codeUpdates map[common.Hash][]byte) {
@@ -68,3 +150,118 @@ func pluginStateUpdate(blockRoot, parentRoot common.Hash, destructs map[common.H
 	}
 	PluginStateUpdate(plugins.DefaultPluginLoader, blockRoot, parentRoot, destructs, accounts, storage, codeUpdates)
 }
+
+func newDiffAccount(data *types.StateAccount) *statediff.Account {
+	if data == nil {
+		return nil
+	}
+	return &statediff.Account{
+		Nonce:       data.Nonce,
+		Balance:     new(big.Int).Set(data.Balance),
+		CodeHash:    core.BytesToHash(data.CodeHash),
+		StorageRoot: core.Hash(data.Root),
+	}
+}
+
+// resetOrigin records the current account as the origin of the next diff, if
+// StateDiff plugins track the changes of the state.
+func (s *stateObject) resetOrigin() {
+	if !s.db.diffing {
+		return
+	}
+	s.origin, s.diffStorage, s.destructed = nil, nil, false
+	if !s.deleted {
+		origin := s.data
+		origin.Balance = new(big.Int).Set(s.data.Balance)
+		s.origin = &origin
+	}
+}
+
+// trackStorageOrigin records the committed value of a slot about to be updated,
+// unless the slot was already updated since the last commit.
+func (s *stateObject) trackStorageOrigin(key common.Hash) {
+	if !s.db.diffing {
+		return
+	}
+	if _, ok := s.diffStorage[key]; ok {
+		return
+	}
+	if s.diffStorage == nil {
+		s.diffStorage = make(Storage)
+	}
+	s.diffStorage[key] = s.originStorage[key]
+}
+
+// diff returns how the account changed since the last commit, or nil if it
+// did not.
+func (s *stateObject) diff() *statediff.AccountDiff {
+	diff := &statediff.AccountDiff{
+		Before:     newDiffAccount(s.origin),
+		Destructed: s.destructed || (s.deleted && s.origin != nil),
+	}
+	if !s.deleted {
+		diff.After = newDiffAccount(&s.data)
+		for key, before := range s.diffStorage {
+			if after := s.originStorage[key]; after != before {
+				if diff.Storage == nil {
+					diff.Storage = make(map[core.Hash]statediff.Slot)
+				}
+				diff.Storage[core.Hash(key)] = statediff.Slot{Before: core.Hash(before), After: core.Hash(after)}
+			}
+		}
+	}
+	if !diff.Destructed && len(diff.Storage) == 0 && sameDiffAccount(diff.Before, diff.After) {
+		return nil
+	}
+	return diff
+}
+
+func sameDiffAccount(a, b *statediff.Account) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Nonce == b.Nonce && a.Balance.Cmp(b.Balance) == 0 && a.CodeHash == b.CodeHash && a.StorageRoot == b.StorageRoot
+}
+
+func stateDiffHooks(pl *plugins.PluginLoader) []interface{} {
+	return pl.Lookup("StateDiff", func(item interface{}) bool {
+		_, ok := item.(func(core.Hash, core.Hash, map[core.Address]*statediff.AccountDiff))
+		return ok
+	})
+}
+
+// PluginStateDiff delivers the accounts a committed state changed, keyed by
+// address, along with the roots of the state and of its parent. It complements
+// StateUpdate for plugins that need addresses, slot keys and decoded accounts
+// rather than hashes and RLP.
+func PluginStateDiff(pl *plugins.PluginLoader, root, parent common.Hash, diff map[core.Address]*statediff.AccountDiff) {
+	for _, fni := range stateDiffHooks(pl) {
+		if fn, ok := fni.(func(core.Hash, core.Hash, map[core.Address]*statediff.AccountDiff)); ok {
+			fn(core.Hash(root), core.Hash(parent), diff)
+		}
+	}
+}
+
+// pluginTracksStateDiff reports whether plugins receive state diffs. States
+// only track the origin of their accounts when they do, as it is a cost paid
+// on every account loaded.
+func pluginTracksStateDiff() bool {
+	if plugins.DefaultPluginLoader == nil {
+		return false
+	}
+	return len(stateDiffHooks(plugins.DefaultPluginLoader)) > 0
+}
+
+func pluginStateDiff(root, parent common.Hash, objects []*stateObject) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting StateDiff, but default PluginLoader has not been initialized")
+		return
+	}
+	diff := make(map[core.Address]*statediff.AccountDiff)
+	for _, obj := range objects {
+		if d := obj.diff(); d != nil {
+			diff[core.Address(obj.address)] = d
+		}
+	}
+	PluginStateDiff(plugins.DefaultPluginLoader, root, parent, diff)
+}
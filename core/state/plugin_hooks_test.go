@@ -0,0 +1,192 @@
+package state
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/plugins"
+	"github.com/ethereum/go-ethereum/plugins/statediff"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+func TestPluginSnapshotReads(t *testing.T) {
+	var (
+		db      = NewDatabase(rawdb.NewMemoryDatabase())
+		served  = common.Address{0x01}
+		missing = common.Address{0x02}
+		slot    = common.Hash{0x03}
+	)
+	// Commit a state the trie serves, with values the plugin overrides.
+	state, _ := New(common.Hash{}, db, nil)
+	state.SetBalance(served, big.NewInt(1))
+	state.SetState(served, slot, common.Hash{0x01})
+	state.SetBalance(missing, big.NewInt(1))
+	root, _ := state.Commit(false)
+
+	var (
+		accounts = map[core.Hash][]byte{
+			core.Hash(crypto.Keccak256Hash(served[:])): snapshot.SlimAccountRLP(0, big.NewInt(2), emptyRoot, emptyCodeHash),
+		}
+		value, _ = rlp.EncodeToBytes(common.Hash{0x02}.Bytes())
+		reads    int
+	)
+	old := plugins.DefaultPluginLoader
+	plugins.DefaultPluginLoader = &plugins.PluginLoader{
+		LookupCache: map[string][]interface{}{
+			"GetSnapshotAccount": {func(r, hash core.Hash) ([]byte, error) {
+				if r != core.Hash(root) {
+					t.Errorf("Unexpected snapshot root %x", r)
+				}
+				reads++
+				if data, ok := accounts[hash]; ok {
+					return data, nil
+				}
+				return nil, errors.New("unknown account")
+			}},
+			"GetSnapshotStorage": {func(r, account, hash core.Hash) ([]byte, error) {
+				return value, nil
+			}},
+		},
+	}
+	defer func() { plugins.DefaultPluginLoader = old }()
+
+	state, _ = New(root, db, nil)
+
+	// Copies keep reading from the plugin.
+	if balance := state.Copy().GetBalance(served); balance.Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("Expected the plugin to serve the copy, got %v", balance)
+	}
+	if balance := state.GetBalance(served); balance.Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("Expected the plugin to serve the account balance, got %v", balance)
+	}
+	if value := state.GetState(served, slot); value != (common.Hash{0x02}) {
+		t.Errorf("Expected the plugin to serve the storage slot, got %x", value)
+	}
+	// Reads the plugin fails fall back to the trie.
+	if balance := state.GetBalance(missing); balance.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("Expected the trie to serve the account balance, got %v", balance)
+	}
+	if reads != 3 {
+		t.Errorf("Expected 3 plugin account reads, got %d", reads)
+	}
+}
+
+func TestPluginSnapshotReadFault(t *testing.T) {
+	var (
+		db   = NewDatabase(rawdb.NewMemoryDatabase())
+		addr = common.Address{0x01}
+	)
+	state, _ := New(common.Hash{}, db, nil)
+	state.SetBalance(addr, big.NewInt(1))
+	root, _ := state.Commit(false)
+
+	done := plugins.GuardedHookTester("GetSnapshotAccount", func(r, hash core.Hash) ([]byte, error) {
+		panic("faulty plugin")
+	})
+	defer done()
+
+	// A faulty plugin does not make accounts appear missing.
+	state, _ = New(root, db, nil)
+	if balance := state.GetBalance(addr); balance.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("Expected the trie to serve the account balance, got %v", balance)
+	}
+}
+
+func TestStateDiffHook(t *testing.T) {
+	var (
+		db         = NewDatabase(rawdb.NewMemoryDatabase())
+		changed    = common.Address{0x01}
+		created    = common.Address{0x02}
+		destructed = common.Address{0x03}
+		untouched  = common.Address{0x04}
+		slot1      = common.Hash{0x01}
+		slot2      = common.Hash{0x02}
+	)
+	state, _ := New(common.Hash{}, db, nil)
+	state.SetBalance(changed, big.NewInt(1))
+	state.SetState(changed, slot1, common.Hash{0x01})
+	state.SetState(changed, slot2, common.Hash{0x02})
+	state.SetBalance(destructed, big.NewInt(1))
+	state.SetBalance(untouched, big.NewInt(1))
+	parent, _ := state.Commit(false)
+
+	var (
+		diffs []map[core.Address]*statediff.AccountDiff
+		roots [][2]core.Hash
+	)
+	old := plugins.DefaultPluginLoader
+	plugins.DefaultPluginLoader = &plugins.PluginLoader{
+		LookupCache: map[string][]interface{}{
+			"StateDiff": {func(root, parent core.Hash, diff map[core.Address]*statediff.AccountDiff) {
+				diffs = append(diffs, diff)
+				roots = append(roots, [2]core.Hash{root, parent})
+			}},
+		},
+	}
+	defer func() { plugins.DefaultPluginLoader = old }()
+
+	state, _ = New(parent, db, nil)
+	state.SetBalance(changed, big.NewInt(5))
+	state.SetState(changed, slot1, common.Hash{0x03})
+	state.SetState(changed, slot2, common.Hash{})
+	state.Finalise(true)
+	state.SetState(changed, slot1, common.Hash{0x04}) // Updated twice in the block
+	state.SetBalance(created, big.NewInt(2))
+	state.Suicide(destructed)
+	state.GetBalance(untouched)
+	root, _ := state.Commit(true)
+
+	if len(diffs) != 1 || roots[0] != [2]core.Hash{core.Hash(root), core.Hash(parent)} {
+		t.Fatalf("Expected one state diff from %x to %x, got %d (%x)", parent, root, len(diffs), roots)
+	}
+	diff := diffs[0]
+	if len(diff) != 3 {
+		t.Errorf("Expected 3 changed accounts, got %d", len(diff))
+	}
+	if d := diff[core.Address(changed)]; d == nil || d.Before.Balance.Int64() != 1 || d.After.Balance.Int64() != 5 || d.Destructed {
+		t.Errorf("Unexpected diff of changed account: %+v", d)
+	} else {
+		want := map[core.Hash]statediff.Slot{
+			core.Hash(slot1): {Before: core.Hash{0x01}, After: core.Hash{0x04}},
+			core.Hash(slot2): {Before: core.Hash{0x02}},
+		}
+		if len(d.Storage) != len(want) || d.Storage[core.Hash(slot1)] != want[core.Hash(slot1)] || d.Storage[core.Hash(slot2)] != want[core.Hash(slot2)] {
+			t.Errorf("Unexpected storage diff %v, want %v", d.Storage, want)
+		}
+		if d.Before.StorageRoot == d.After.StorageRoot {
+			t.Errorf("Expected the storage root to change")
+		}
+	}
+	if d := diff[core.Address(created)]; d == nil || d.Before != nil || d.After.Balance.Int64() != 2 {
+		t.Errorf("Unexpected diff of created account: %+v", d)
+	}
+	if d := diff[core.Address(destructed)]; d == nil || d.Before == nil || d.After != nil || !d.Destructed {
+		t.Errorf("Unexpected diff of destructed account: %+v", d)
+	}
+	// A following commit only reports the changes since this one.
+	state.SetBalance(created, big.NewInt(3))
+	state.Commit(true)
+	if len(diffs) != 2 || len(diffs[1]) != 1 || diffs[1][core.Address(created)].Before.Balance.Int64() != 2 {
+		t.Errorf("Unexpected second state diff %v", diffs[1:])
+	}
+}
+
+func TestStateDiffUntracked(t *testing.T) {
+	state, _ := New(common.Hash{}, NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	state.SetBalance(common.Address{0x01}, big.NewInt(1))
+	state.SetState(common.Address{0x01}, common.Hash{0x01}, common.Hash{0x01})
+	root, _ := state.Commit(false)
+
+	state, _ = New(root, state.db, nil)
+	state.SetState(common.Address{0x01}, common.Hash{0x01}, common.Hash{0x02})
+	state.Commit(false)
+	if obj := state.getStateObject(common.Address{0x01}); obj.origin != nil || obj.diffStorage != nil {
+		t.Errorf("Expected account origins not to be tracked without StateDiff plugins")
+	}
+}
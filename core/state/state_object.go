@@ -91,6 +91,11 @@ type stateObject struct {
 	dirtyCode bool // true if the code was updated
 	suicided  bool
 	deleted   bool
+
+	// Origin tracking for the StateDiff plugin hook.
+	origin      *types.StateAccount // Account as of the last commit, nil if it did not exist
+	diffStorage Storage             // Values as of the last commit of the slots updated since
+	destructed  bool                // Whether the storage as of the last commit was cleared
 }
 
 // empty returns whether the account is considered empty.
@@ -326,6 +331,7 @@ func (s *stateObject) updateTrie(db Database) Trie {
 		if value == s.originStorage[key] {
 			continue
 		}
+		s.trackStorageOrigin(key)
 		s.originStorage[key] = value
 
 		var v []byte
@@ -441,6 +447,9 @@ func (s *stateObject) deepCopy(db *StateDB) *stateObject {
 	stateObject.suicided = s.suicided
 	stateObject.dirtyCode = s.dirtyCode
 	stateObject.deleted = s.deleted
+	stateObject.origin = s.origin
+	stateObject.diffStorage = s.diffStorage.Copy()
+	stateObject.destructed = s.destructed
 	return stateObject
 }
 
@@ -125,6 +125,8 @@ type StateDB struct {
 	StorageUpdated int
 	AccountDeleted int
 	StorageDeleted int
+
+	diffing bool // Whether StateDiff plugins track the changes of the state, PluGeth injection
 }
 
 // New creates a new state from a given trie.
@@ -162,6 +164,7 @@ func New(root common.Hash, db Database, snaps *snapshot.Tree) (*StateDB, error)
 		sdb.snapAccounts = make(map[common.Hash][]byte)
 		sdb.snapStorage = make(map[common.Hash]map[common.Hash][]byte)
 	}
+	sdb.diffing = pluginTracksStateDiff()
 	// End PluGeth section
 	return sdb, nil
 }
@@ -565,6 +568,7 @@ func (s *StateDB) getDeletedStateObject(addr common.Address) *stateObject {
 	}
 	// Insert into the live set
 	obj := newObject(s, addr, *data)
+	obj.resetOrigin() // PluGeth injection
 	s.setStateObject(obj)
 	return obj
 }
@@ -595,6 +599,11 @@ func (s *StateDB) createObject(addr common.Address) (newobj, prev *stateObject)
 		}
 	}
 	newobj = newObject(s, addr, types.StateAccount{})
+	//begin PluGeth code injection
+	if prev != nil {
+		newobj.origin, newobj.destructed = prev.origin, prev.origin != nil || prev.destructed
+	}
+	//end PluGeth injection
 	if prev == nil {
 		s.journal.append(createObjectChange{account: &addr})
 	} else {
@@ -670,6 +679,7 @@ func (s *StateDB) Copy() *StateDB {
 		preimages:           make(map[common.Hash][]byte, len(s.preimages)),
 		journal:             newJournal(),
 		hasher:              crypto.NewKeccakState(),
+		diffing:             s.diffing, // PluGeth injection
 	}
 	// Copy the dirty states, logs, and preimages
 	for addr := range s.journal.dirties {
@@ -726,7 +736,7 @@ func (s *StateDB) Copy() *StateDB {
 	if s.prefetcher != nil {
 		state.prefetcher = s.prefetcher.copy()
 	}
-	if s.snaps != nil {
+	if s.snap != nil { // This condition (formerly s.snaps != nil) was changed by PluGeth to carry plugin snapshots
 		// In order for the miner to be able to use and make additions
 		// to the snapshot tree, we need to copy that aswell.
 		// Otherwise, any block mined by ourselves will cause gaps in the tree,
@@ -920,7 +930,11 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 	var storageCommitted int
 	codeUpdates := make(map[common.Hash][]byte)
 	codeWriter := s.db.TrieDB().DiskDB().NewBatch()
+	var committed []*stateObject // PluGeth injection
 	for addr := range s.stateObjectsDirty {
+		if s.diffing { // PluGeth injection
+			committed = append(committed, s.stateObjects[addr])
+		}
 		if obj := s.stateObjects[addr]; !obj.deleted {
 			// Write any contract code associated with the state object
 			if obj.code != nil && obj.dirtyCode {
@@ -976,6 +990,16 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (common.Hash, error) {
 		s.AccountUpdated, s.AccountDeleted = 0, 0
 		s.StorageUpdated, s.StorageDeleted = 0, 0
 	}
+	//begin PluGeth code injection
+	if s.diffing {
+		if root != s.originalRoot {
+			pluginStateDiff(root, s.originalRoot, committed)
+		}
+		for _, obj := range committed {
+			obj.resetOrigin()
+		}
+	}
+	//end PluGeth injection
 	// If snapshotting is enabled, update the snapshot tree with this new version
 	if s.snap != nil {
 		if metrics.EnabledExpensive {
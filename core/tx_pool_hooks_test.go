@@ -0,0 +1,78 @@
+package core
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/plugins"
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+func TestTxPoolHooks(t *testing.T) {
+	var (
+		errRejected = errors.New("rejected by plugin")
+		added       []core.Hash
+		replaced    [][2]core.Hash
+		dropped     = make(map[core.Hash]string)
+	)
+	old := plugins.DefaultPluginLoader
+	plugins.DefaultPluginLoader = &plugins.PluginLoader{
+		LookupCache: map[string][]interface{}{
+			"ValidatePoolTransaction": {func(txBytes []byte, local bool) error {
+				var tx types.Transaction
+				if err := tx.UnmarshalBinary(txBytes); err != nil {
+					t.Errorf("Could not decode transaction: %v", err)
+				}
+				if !local && tx.Nonce() == 5 {
+					return errRejected
+				}
+				return nil
+			}},
+			"PoolTransactionAdded": {func(txBytes []byte, local bool) {
+				var tx types.Transaction
+				tx.UnmarshalBinary(txBytes)
+				added = append(added, core.Hash(tx.Hash()))
+			}},
+			"PoolTransactionReplaced": {func(old, new core.Hash) {
+				replaced = append(replaced, [2]core.Hash{old, new})
+			}},
+			"PoolTransactionDropped": {func(hash core.Hash, reason string) {
+				dropped[hash] = reason
+			}},
+		},
+	}
+	defer func() { plugins.DefaultPluginLoader = old }()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+	localKey, _ := crypto.GenerateKey()
+	testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+	testAddBalance(pool, crypto.PubkeyToAddress(localKey.PublicKey), big.NewInt(1000000000))
+
+	if err := pool.AddRemotesSync([]*types.Transaction{transaction(5, 100000, localKey)})[0]; err != errRejected {
+		t.Fatalf("Expected plugin to reject transaction, got %v", err)
+	}
+	if err := pool.AddLocal(transaction(5, 100000, localKey)); err != nil {
+		t.Fatalf("Expected local transaction to be accepted, got %v", err)
+	}
+	first, second := pricedTransaction(0, 100000, big.NewInt(1), key), pricedTransaction(0, 100000, big.NewInt(2), key)
+	if err := pool.AddRemotesSync([]*types.Transaction{first})[0]; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := pool.AddRemotesSync([]*types.Transaction{second})[0]; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(added) != 3 || added[1] != core.Hash(first.Hash()) || added[2] != core.Hash(second.Hash()) {
+		t.Errorf("Unexpected added transactions %v", added)
+	}
+	if len(replaced) != 1 || replaced[0] != [2]core.Hash{core.Hash(first.Hash()), core.Hash(second.Hash())} {
+		t.Errorf("Unexpected replaced transactions %v", replaced)
+	}
+	pool.SetGasPrice(big.NewInt(3))
+	if reason := dropped[core.Hash(second.Hash())]; reason != poolDropUnderpriced {
+		t.Errorf("Expected underpriced transaction to be dropped, got %q", reason)
+	}
+}
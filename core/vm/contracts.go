@@ -126,18 +126,34 @@ func init() {
 	}
 }
 
-// ActivePrecompiles returns the precompiles enabled with the current configuration.
+// ActivePrecompiles returns the precompiles enabled with the current configuration,
+// including those plugins provide for the block of the rules.
 func ActivePrecompiles(rules params.Rules) []common.Address {
+	var (
+		precompiles map[common.Address]PrecompiledContract
+		addresses   []common.Address
+	)
 	switch {
 	case rules.IsBerlin:
-		return PrecompiledAddressesBerlin
+		precompiles, addresses = PrecompiledContractsBerlin, PrecompiledAddressesBerlin
 	case rules.IsIstanbul:
-		return PrecompiledAddressesIstanbul
+		precompiles, addresses = PrecompiledContractsIstanbul, PrecompiledAddressesIstanbul
 	case rules.IsByzantium:
-		return PrecompiledAddressesByzantium
+		precompiles, addresses = PrecompiledContractsByzantium, PrecompiledAddressesByzantium
 	default:
-		return PrecompiledAddressesHomestead
+		precompiles, addresses = PrecompiledContractsHomestead, PrecompiledAddressesHomestead
+	}
+	plugin := pluginPrecompiles(rules.BlockNumber)
+	if len(plugin) == 0 {
+		return addresses
+	}
+	addresses = append([]common.Address{}, addresses...)
+	for addr := range plugin {
+		if _, ok := precompiles[addr]; !ok {
+			addresses = append(addresses, addr)
+		}
 	}
+	return addresses
 }
 
 // RunPrecompiledContract runs and evaluates the output of a precompiled contract.
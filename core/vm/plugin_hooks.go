@@ -1,5 +1,128 @@
 package vm
 
+import (
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/plugins"
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
 func (st *Stack) Len() int {
 	return len(st.data)
 }
+
+// PluginPrecompile is a precompiled contract provided by a plugin, active from
+// the block ActivationBlock returns onwards. Its methods only involve builtin
+// types, so plugins implement it without importing geth.
+type PluginPrecompile interface {
+	PrecompiledContract
+	ActivationBlock() uint64
+}
+
+// pluginPrecompile is a precompiled contract provided by a plugin, at addr.
+type pluginPrecompile struct {
+	addr     common.Address
+	contract PluginPrecompile
+}
+
+// precompileCache holds the precompiled contracts of the Precompiles hooks
+// they were resolved from, and the sets of contracts active from each
+// activation block.
+type precompileCache struct {
+	lock      sync.Mutex
+	fns       []interface{}
+	contracts []pluginPrecompile // in dispatch order
+	sets      map[uint64]map[common.Address]PrecompiledContract
+}
+
+var pluginPrecompileCache precompileCache
+
+// PluginPrecompiles returns the precompiled contracts plugins provide that are
+// active at block number. Each hook returns its contracts by address, which
+// must implement PluginPrecompile. A contract does not replace one of a
+// preceding plugin at the same address.
+//
+// The contracts affect consensus, so the hooks are not isolated from panics
+// (see LookupCritical), and they must return the same contracts on every
+// invocation: the hooks are only invoked again once plugins are reloaded.
+func PluginPrecompiles(pl *plugins.PluginLoader, number *big.Int) map[common.Address]PrecompiledContract {
+	fnList := pl.LookupCritical("Precompiles", func(item interface{}) bool {
+		_, ok := item.(func() map[core.Address]interface{})
+		return ok
+	})
+	if number == nil || !number.IsUint64() || len(fnList) == 0 {
+		return nil
+	}
+	return pluginPrecompileCache.active(fnList, number)
+}
+
+// active returns the contracts of the hooks in fnList active at block number.
+// The set returned is shared and must not be modified.
+func (c *precompileCache) active(fnList []interface{}, number *big.Int) map[common.Address]PrecompiledContract {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(c.fns) != len(fnList) || &c.fns[0] != &fnList[0] {
+		c.resolve(fnList)
+	}
+	// Contracts change at activation blocks only, so the set active from the
+	// latest activation block passed applies.
+	var (
+		activation uint64
+		active     bool
+	)
+	for _, p := range c.contracts {
+		if block := p.contract.ActivationBlock(); block <= number.Uint64() && (!active || block > activation) {
+			activation, active = block, true
+		}
+	}
+	if !active {
+		return nil
+	}
+	if set, ok := c.sets[activation]; ok {
+		return set
+	}
+	set := make(map[common.Address]PrecompiledContract)
+	for _, p := range c.contracts {
+		if p.contract.ActivationBlock() > activation {
+			continue
+		}
+		if _, ok := set[p.addr]; !ok {
+			set[p.addr] = p.contract
+		}
+	}
+	c.sets[activation] = set
+	return set
+}
+
+// resolve invokes the hooks in fnList for their contracts.
+func (c *precompileCache) resolve(fnList []interface{}) {
+	c.fns, c.contracts = fnList, nil
+	c.sets = make(map[uint64]map[common.Address]PrecompiledContract)
+	for _, fni := range fnList {
+		fn, ok := fni.(func() map[core.Address]interface{})
+		if !ok {
+			continue
+		}
+		for addr, item := range fn() {
+			p, ok := item.(PluginPrecompile)
+			if !ok {
+				log.Warn("Ignoring invalid plugin precompile", "address", common.Address(addr))
+				continue
+			}
+			c.contracts = append(c.contracts, pluginPrecompile{common.Address(addr), p})
+		}
+	}
+}
+
+// pluginPrecompiles returns the plugin precompiles of the default loader, if
+// any. It is invoked for every EVM, so a missing loader is not reported.
+func pluginPrecompiles(number *big.Int) map[common.Address]PrecompiledContract {
+	if plugins.DefaultPluginLoader == nil {
+		return nil
+	}
+	return PluginPrecompiles(plugins.DefaultPluginLoader, number)
+}
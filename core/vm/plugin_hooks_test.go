@@ -0,0 +1,111 @@
+package vm
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/plugins"
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+// reversePrecompile returns its input reversed, from block 5 onwards.
+type reversePrecompile struct{}
+
+func (reversePrecompile) RequiredGas(input []byte) uint64 { return uint64(len(input)) }
+func (reversePrecompile) ActivationBlock() uint64         { return 5 }
+
+func (reversePrecompile) Run(input []byte) ([]byte, error) {
+	output := make([]byte, len(input))
+	for i, b := range input {
+		output[len(input)-1-i] = b
+	}
+	return output, nil
+}
+
+func TestPluginPrecompiles(t *testing.T) {
+	var (
+		custom = common.Address{0x01, 0x00}
+		native = common.BytesToAddress([]byte{0x02})
+	)
+	var calls int
+	old := plugins.DefaultPluginLoader
+	plugins.DefaultPluginLoader = &plugins.PluginLoader{
+		LookupCache: map[string][]interface{}{
+			"Precompiles": {func() map[core.Address]interface{} {
+				calls++
+				return map[core.Address]interface{}{
+					core.Address(custom): reversePrecompile{},
+					core.Address(native): reversePrecompile{},
+					core.Address{0x02, 0x00}: "invalid",
+				}
+			}},
+		},
+	}
+	defer func() { plugins.DefaultPluginLoader = old }()
+
+	input := []byte{1, 2, 3}
+	for _, tt := range []struct {
+		number uint64
+		active bool
+	}{{4, false}, {5, true}, {6, true}} {
+		rules := params.AllEthashProtocolChanges.Rules(new(big.Int).SetUint64(tt.number), false)
+		addresses := ActivePrecompiles(rules)
+		if len(addresses) != len(PrecompiledAddressesBerlin)+btoi(tt.active) {
+			t.Errorf("block %d: unexpected active precompiles %v", tt.number, addresses)
+		}
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		statedb.PrepareAccessList(common.Address{}, nil, addresses, nil)
+		if statedb.AddressInAccessList(custom) != tt.active {
+			t.Errorf("block %d: unexpected access list warming of plugin precompile", tt.number)
+		}
+		evm := NewEVM(BlockContext{
+			BlockNumber: new(big.Int).SetUint64(tt.number),
+			CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+			Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		}, TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+
+		ret, gas, err := evm.Call(AccountRef(common.Address{}), custom, input, 100, new(big.Int))
+		if err != nil {
+			t.Fatalf("block %d: call failed: %v", tt.number, err)
+		}
+		if tt.active && (!bytes.Equal(ret, []byte{3, 2, 1}) || gas != 97) {
+			t.Errorf("block %d: unexpected plugin precompile result %x, gas left %d", tt.number, ret, gas)
+		}
+		if !tt.active && (len(ret) != 0 || gas != 100) {
+			t.Errorf("block %d: plugin precompile ran before activation", tt.number)
+		}
+		// Plugins cannot replace the precompiles of the protocol.
+		if ret, _, _ := evm.Call(AccountRef(common.Address{}), native, input, 100, new(big.Int)); bytes.Equal(ret, []byte{3, 2, 1}) {
+			t.Errorf("block %d: plugin replaced native precompile", tt.number)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected the precompiles of plugins to be resolved once, got %d hook calls", calls)
+	}
+}
+
+func TestPluginPrecompilesFault(t *testing.T) {
+	done := plugins.GuardedHookTester("Precompiles", func() map[core.Address]interface{} {
+		panic("faulty plugin")
+	})
+	defer done()
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a panicking Precompiles hook not to be recovered")
+		}
+	}()
+	NewEVM(BlockContext{BlockNumber: big.NewInt(1)}, TxContext{}, nil, params.AllEthashProtocolChanges, Config{})
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -598,6 +598,9 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td, ttd *
 	if d.syncInitHook != nil {
 		d.syncInitHook(origin, height)
 	}
+	pluginSyncStarted(mode, origin, height)
+	defer func() { pluginSyncCompleted(mode, err) }()
+
 	var headerFetcher func() error
 	if !beaconMode {
 		// In legacy mode, headers are retrieved from the network
@@ -616,6 +619,7 @@ func (d *Downloader) syncWithPeer(p *peerConnection, hash common.Hash, td, ttd *
 		d.pivotLock.Lock()
 		d.pivotHeader = pivot
 		d.pivotLock.Unlock()
+		pluginSyncPivot(pivot)
 
 		fetchers = append(fetchers, func() error { return d.processSnapSyncContent() })
 	} else if mode == FullSync {
@@ -1075,6 +1079,7 @@ func (d *Downloader) fetchHeaders(p *peerConnection, from uint64, head uint64) e
 				d.pivotLock.Lock()
 				d.pivotHeader = headers[0]
 				d.pivotLock.Unlock()
+				pluginSyncPivot(headers[0])
 
 				// Write out the pivot into the database so a rollback beyond
 				// it will reenable snap sync and update the state root that
@@ -1653,6 +1658,7 @@ func (d *Downloader) processSnapSyncContent() error {
 				d.pivotLock.Lock()
 				d.pivotHeader = pivot
 				d.pivotLock.Unlock()
+				pluginSyncPivot(pivot)
 
 				// Write out the pivot into the database so a rollback beyond it will
 				// reenable snap sync
@@ -0,0 +1,76 @@
+package downloader
+
+import (
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/plugins"
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+// PluginSyncStarted notifies plugins of a sync cycle starting, with the sync
+// mode ("full", "snap" or "light"), the common ancestor with the remote chain
+// and the height being synced to.
+func PluginSyncStarted(pl *plugins.PluginLoader, mode SyncMode, origin, height uint64) {
+	fnList := pl.Lookup("SyncStarted", func(item interface{}) bool {
+		_, ok := item.(func(string, uint64, uint64))
+		return ok
+	})
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(string, uint64, uint64)); ok {
+			fn(mode.String(), origin, height)
+		}
+	}
+}
+
+func pluginSyncStarted(mode SyncMode, origin, height uint64) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting SyncStarted, but default PluginLoader has not been initialized")
+		return
+	}
+	PluginSyncStarted(plugins.DefaultPluginLoader, mode, origin, height)
+}
+
+// PluginSyncPivot notifies plugins of the pivot block of a snap sync, when it
+// is chosen and whenever it moves because the state of the previous pivot
+// became stale.
+func PluginSyncPivot(pl *plugins.PluginLoader, pivot *types.Header) {
+	fnList := pl.Lookup("SyncPivot", func(item interface{}) bool {
+		_, ok := item.(func(uint64, core.Hash, core.Hash))
+		return ok
+	})
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(uint64, core.Hash, core.Hash)); ok {
+			fn(pivot.Number.Uint64(), core.Hash(pivot.Hash()), core.Hash(pivot.Root))
+		}
+	}
+}
+
+func pluginSyncPivot(pivot *types.Header) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting SyncPivot, but default PluginLoader has not been initialized")
+		return
+	}
+	PluginSyncPivot(plugins.DefaultPluginLoader, pivot)
+}
+
+// PluginSyncCompleted notifies plugins of a sync cycle terminating, with the
+// error that aborted it, if any.
+func PluginSyncCompleted(pl *plugins.PluginLoader, mode SyncMode, err error) {
+	fnList := pl.Lookup("SyncCompleted", func(item interface{}) bool {
+		_, ok := item.(func(string, error))
+		return ok
+	})
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(string, error)); ok {
+			fn(mode.String(), err)
+		}
+	}
+}
+
+func pluginSyncCompleted(mode SyncMode, err error) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting SyncCompleted, but default PluginLoader has not been initialized")
+		return
+	}
+	PluginSyncCompleted(plugins.DefaultPluginLoader, mode, err)
+}
@@ -214,8 +214,12 @@ type Config struct {
 
 // CreateConsensusEngine creates a consensus engine for the given chain configuration.
 func CreateConsensusEngine(stack *node.Node, chainConfig *params.ChainConfig, config *ethash.Config, notify []string, noverify bool, db ethdb.Database) consensus.Engine {
-	// If proof-of-authority is requested, set it up
+	// If a plugin provides the consensus engine, wrap it as any other
 	var engine consensus.Engine
+	if engine = pluginCreateEngine(chainConfig, db); engine != nil {
+		return beacon.New(engine)
+	}
+	// If proof-of-authority is requested, set it up
 	if chainConfig.Clique != nil {
 		engine = clique.New(chainConfig.Clique, db)
 	} else {
@@ -0,0 +1,201 @@
+package ethconfig
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/plugins/wrappers"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+// PluginEngine is a consensus engine implemented by a plugin in terms of
+// plugeth-utils types. Headers and blocks are RLP encoded, and chain access is
+// given as a function retrieving the RLP encoded header of a hash and number,
+// or nil if the header is unknown.
+//
+// Finalize returns the balances to credit to accounts, block rewards for
+// instance, which are applied to the state before its root is computed. The
+// RLP encoded blocks sent to the results channel of Seal are the sealed ones.
+//
+// Plugins may also implement APIs() []core.API to expose RPC services.
+type PluginEngine interface {
+	Author(header []byte) (core.Address, error)
+	VerifyHeader(getHeader func(core.Hash, uint64) []byte, header []byte, seal bool) error
+	VerifyUncles(getHeader func(core.Hash, uint64) []byte, block []byte) error
+	Prepare(getHeader func(core.Hash, uint64) []byte, header []byte) ([]byte, error)
+	Finalize(getHeader func(core.Hash, uint64) []byte, header []byte, state core.StateDB, txs [][]byte, uncles [][]byte) map[core.Address]*big.Int
+	Seal(getHeader func(core.Hash, uint64) []byte, block []byte, results chan<- []byte, stop <-chan struct{}) error
+	SealHash(header []byte) core.Hash
+	CalcDifficulty(getHeader func(core.Hash, uint64) []byte, time uint64, parent []byte) *big.Int
+	Close() error
+}
+
+// pluginEngine adapts a PluginEngine to consensus.Engine.
+type pluginEngine struct {
+	engine PluginEngine
+}
+
+// headerGetter returns the header retrieval function given to plugins, looking
+// up the headers of a batch being verified before those of the chain.
+func headerGetter(chain consensus.ChainHeaderReader, parents []*types.Header) func(core.Hash, uint64) []byte {
+	return func(hash core.Hash, number uint64) []byte {
+		var header *types.Header
+		for i := len(parents) - 1; i >= 0; i-- {
+			if parents[i].Hash() == common.Hash(hash) {
+				header = parents[i]
+				break
+			}
+		}
+		if header == nil {
+			header = chain.GetHeader(common.Hash(hash), number)
+		}
+		if header == nil {
+			return nil
+		}
+		data, _ := rlp.EncodeToBytes(header)
+		return data
+	}
+}
+
+func encodeHeader(header *types.Header) []byte {
+	data, _ := rlp.EncodeToBytes(header)
+	return data
+}
+
+func (e *pluginEngine) Author(header *types.Header) (common.Address, error) {
+	author, err := e.engine.Author(encodeHeader(header))
+	return common.Address(author), err
+}
+
+func (e *pluginEngine) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header, seal bool) error {
+	return e.engine.VerifyHeader(headerGetter(chain, nil), encodeHeader(header), seal)
+}
+
+func (e *pluginEngine) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
+	abort := make(chan struct{})
+	results := make(chan error, len(headers))
+
+	go func() {
+		for i, header := range headers {
+			err := e.engine.VerifyHeader(headerGetter(chain, headers[:i]), encodeHeader(header), seals[i])
+
+			select {
+			case <-abort:
+				return
+			case results <- err:
+			}
+		}
+	}()
+	return abort, results
+}
+
+func (e *pluginEngine) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
+	data, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return err
+	}
+	return e.engine.VerifyUncles(headerGetter(chain, nil), data)
+}
+
+func (e *pluginEngine) Prepare(chain consensus.ChainHeaderReader, header *types.Header) error {
+	data, err := e.engine.Prepare(headerGetter(chain, nil), encodeHeader(header))
+	if err != nil {
+		return err
+	}
+	prepared := new(types.Header)
+	if err := rlp.DecodeBytes(data, prepared); err != nil {
+		return err
+	}
+	*header = *prepared
+	return nil
+}
+
+func (e *pluginEngine) Finalize(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header) {
+	encTxs := make([][]byte, len(txs))
+	for i, tx := range txs {
+		encTxs[i], _ = tx.MarshalBinary()
+	}
+	encUncles := make([][]byte, len(uncles))
+	for i, uncle := range uncles {
+		encUncles[i] = encodeHeader(uncle)
+	}
+	for addr, amount := range e.engine.Finalize(headerGetter(chain, nil), encodeHeader(header), wrappers.NewWrappedStateDB(state), encTxs, encUncles) {
+		if amount != nil {
+			state.AddBalance(common.Address(addr), amount)
+		}
+	}
+	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
+}
+
+func (e *pluginEngine) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	// Finalize block
+	e.Finalize(chain, header, state, txs, uncles)
+
+	// Header seems complete, assemble into a block and return
+	return types.NewBlock(header, txs, uncles, receipts, trie.NewStackTrie(nil)), nil
+}
+
+func (e *pluginEngine) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
+	data, err := rlp.EncodeToBytes(block)
+	if err != nil {
+		return err
+	}
+	sealed := make(chan []byte, 1)
+	if err := e.engine.Seal(headerGetter(chain, nil), data, sealed, stop); err != nil {
+		return err
+	}
+	go func() {
+		select {
+		case <-stop:
+			return
+		case data := <-sealed:
+			result := new(types.Block)
+			if err := rlp.DecodeBytes(data, result); err != nil {
+				log.Warn("Failed to decode plugin sealed block", "err", err)
+				return
+			}
+			select {
+			case results <- result:
+			default:
+				log.Warn("Sealing result is not read by miner", "sealhash", e.SealHash(block.Header()))
+			}
+		}
+	}()
+	return nil
+}
+
+func (e *pluginEngine) SealHash(header *types.Header) common.Hash {
+	return common.Hash(e.engine.SealHash(encodeHeader(header)))
+}
+
+func (e *pluginEngine) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, parent *types.Header) *big.Int {
+	return e.engine.CalcDifficulty(headerGetter(chain, nil), time, encodeHeader(parent))
+}
+
+func (e *pluginEngine) APIs(chain consensus.ChainHeaderReader) []rpc.API {
+	provider, ok := e.engine.(interface{ APIs() []core.API })
+	if !ok {
+		return nil
+	}
+	var apis []rpc.API
+	for _, api := range provider.APIs() {
+		apis = append(apis, rpc.API{
+			Namespace: api.Namespace,
+			Version:   api.Version,
+			Service:   api.Service,
+			Public:    api.Public,
+		})
+	}
+	return apis
+}
+
+func (e *pluginEngine) Close() error {
+	return e.engine.Close()
+}
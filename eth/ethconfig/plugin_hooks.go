@@ -0,0 +1,63 @@
+package ethconfig
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/plugins"
+	"github.com/ethereum/go-ethereum/plugins/wrappers"
+	"github.com/openrelayxyz/plugeth-utils/restricted"
+	rparams "github.com/openrelayxyz/plugeth-utils/restricted/params"
+)
+
+// PluginCreateEngine asks plugins for the consensus engine of the chain. Each
+// hook receives the chain configuration and the chain database, and returns
+// either a PluginEngine, a consensus.Engine, or nil to leave the choice to the
+// next plugin. The first engine returned is used.
+//
+// A chain relying on a plugin engine cannot fall back to another one, so the
+// hooks are not isolated from panics (see LookupCritical): a faulty plugin
+// fails startup instead.
+func PluginCreateEngine(pl *plugins.PluginLoader, chainConfig *params.ChainConfig, db ethdb.Database) consensus.Engine {
+	fnList := pl.LookupCritical("CreateEngine", func(item interface{}) bool {
+		_, ok := item.(func(*rparams.ChainConfig, restricted.Database) interface{})
+		return ok
+	})
+	if len(fnList) == 0 {
+		return nil
+	}
+	config := new(rparams.ChainConfig)
+	if data, err := json.Marshal(chainConfig); err != nil {
+		log.Warn("Could not encode chain config for plugins", "err", err)
+	} else if err := json.Unmarshal(data, config); err != nil {
+		log.Warn("Could not decode chain config for plugins", "err", err)
+	}
+	for _, fni := range fnList {
+		fn, ok := fni.(func(*rparams.ChainConfig, restricted.Database) interface{})
+		if !ok {
+			continue
+		}
+		switch engine := fn(config, wrappers.NewWrappedDatabase(db)).(type) {
+		case nil:
+		case consensus.Engine:
+			return engine
+		case PluginEngine:
+			return &pluginEngine{engine}
+		default:
+			log.Warn("Ignoring unsupported plugin consensus engine", "type", fmt.Sprintf("%T", engine))
+		}
+	}
+	return nil
+}
+
+func pluginCreateEngine(chainConfig *params.ChainConfig, db ethdb.Database) consensus.Engine {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting CreateEngine, but default PluginLoader has not been initialized")
+		return nil
+	}
+	return PluginCreateEngine(plugins.DefaultPluginLoader, chainConfig, db)
+}
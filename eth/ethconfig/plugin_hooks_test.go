@@ -0,0 +1,155 @@
+package ethconfig
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/beacon"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/plugins"
+	"github.com/ethereum/go-ethereum/rlp"
+	pcore "github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted"
+	rparams "github.com/openrelayxyz/plugeth-utils/restricted/params"
+)
+
+var testAuthority = common.Address{0xaa}
+
+// testEngine is a plugin engine crediting its authority one wei per block and
+// sealing blocks by setting their extra data.
+type testEngine struct {
+	verified  int
+	finalized int
+}
+
+func (e *testEngine) Author(header []byte) (pcore.Address, error) {
+	return pcore.Address(testAuthority), nil
+}
+
+func (e *testEngine) VerifyHeader(getHeader func(pcore.Hash, uint64) []byte, header []byte, seal bool) error {
+	h := new(types.Header)
+	if err := rlp.DecodeBytes(header, h); err != nil {
+		return err
+	}
+	if getHeader(pcore.Hash(h.ParentHash), h.Number.Uint64()-1) == nil {
+		return errors.New("unknown parent")
+	}
+	if seal && string(h.Extra) != "sealed" {
+		return errors.New("invalid seal")
+	}
+	e.verified++
+	return nil
+}
+
+func (e *testEngine) VerifyUncles(getHeader func(pcore.Hash, uint64) []byte, block []byte) error {
+	return nil
+}
+
+func (e *testEngine) Prepare(getHeader func(pcore.Hash, uint64) []byte, header []byte) ([]byte, error) {
+	return header, nil
+}
+
+func (e *testEngine) Finalize(getHeader func(pcore.Hash, uint64) []byte, header []byte, state pcore.StateDB, txs [][]byte, uncles [][]byte) map[pcore.Address]*big.Int {
+	e.finalized++
+	return map[pcore.Address]*big.Int{pcore.Address(testAuthority): big.NewInt(1)}
+}
+
+func (e *testEngine) Seal(getHeader func(pcore.Hash, uint64) []byte, block []byte, results chan<- []byte, stop <-chan struct{}) error {
+	b := new(types.Block)
+	if err := rlp.DecodeBytes(block, b); err != nil {
+		return err
+	}
+	header := b.Header()
+	header.Extra = []byte("sealed")
+	sealed, _ := rlp.EncodeToBytes(b.WithSeal(header))
+	results <- sealed
+	return nil
+}
+
+func (e *testEngine) SealHash(header []byte) pcore.Hash {
+	return pcore.Hash{}
+}
+
+func (e *testEngine) CalcDifficulty(getHeader func(pcore.Hash, uint64) []byte, time uint64, parent []byte) *big.Int {
+	return big.NewInt(1)
+}
+
+func (e *testEngine) Close() error {
+	return nil
+}
+
+func TestCreateEngineHook(t *testing.T) {
+	var (
+		plugin = new(testEngine)
+		config *rparams.ChainConfig
+	)
+	old := plugins.DefaultPluginLoader
+	plugins.DefaultPluginLoader = &plugins.PluginLoader{
+		LookupCache: map[string][]interface{}{
+			"CreateEngine": {func(c *rparams.ChainConfig, db restricted.Database) interface{} {
+				config = c
+				return plugin
+			}},
+		},
+	}
+	defer func() { plugins.DefaultPluginLoader = old }()
+
+	db := rawdb.NewMemoryDatabase()
+	engine := CreateConsensusEngine(nil, params.TestChainConfig, nil, nil, false, db)
+	if inner := engine.(*beacon.Beacon).InnerEngine(); inner.(*pluginEngine).engine != plugin {
+		t.Fatalf("Expected the beacon engine to wrap the plugin engine, got %T", inner)
+	}
+	if config == nil || config.ChainID.Cmp(params.TestChainConfig.ChainID) != 0 {
+		t.Errorf("Unexpected chain config given to plugin: %v", config)
+	}
+	genesis := (&core.Genesis{Config: params.TestChainConfig, BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(db)
+	blocks, _ := core.GenerateChain(params.TestChainConfig, genesis, engine, db, 3, func(i int, b *core.BlockGen) {
+		b.SetExtra([]byte("sealed"))
+	})
+	results := make(chan *types.Block, 1)
+	if err := engine.Seal(nil, types.NewBlockWithHeader(&types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1)}), results, nil); err != nil {
+		t.Fatalf("Failed to seal block: %v", err)
+	}
+	if sealed := <-results; string(sealed.Extra()) != "sealed" {
+		t.Errorf("Expected the plugin to seal the block, got extra %q", sealed.Extra())
+	}
+	chain, err := core.NewBlockChain(db, nil, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("Failed to insert block %d: %v", n, err)
+	}
+	if plugin.verified != len(blocks) {
+		t.Errorf("Expected %d verified headers, got %d", len(blocks), plugin.verified)
+	}
+	// Blocks are finalized once when generated and once when imported.
+	if plugin.finalized != 2*len(blocks) {
+		t.Errorf("Expected %d finalizations, got %d", 2*len(blocks), plugin.finalized)
+	}
+	state, _ := chain.State()
+	if balance := state.GetBalance(testAuthority); balance.Cmp(big.NewInt(int64(len(blocks)))) != 0 {
+		t.Errorf("Unexpected authority balance %v", balance)
+	}
+}
+
+func TestCreateEngineFault(t *testing.T) {
+	done := plugins.GuardedHookTester("CreateEngine", func(c *rparams.ChainConfig, db restricted.Database) interface{} {
+		panic("faulty plugin")
+	})
+	defer done()
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a faulty plugin engine to fail startup")
+		}
+	}()
+	CreateConsensusEngine(nil, params.TestChainConfig, nil, nil, false, rawdb.NewMemoryDatabase())
+}
@@ -62,12 +62,15 @@ func (h *ethHandler) Handle(peer *eth.Peer, packet eth.Packet) error {
 	switch packet := packet.(type) {
 	case *eth.NewBlockHashesPacket:
 		hashes, numbers := packet.Unpack()
+		pluginNewBlockHashes(peer.ID(), hashes, numbers)
 		return h.handleBlockAnnounces(peer, hashes, numbers)
 
 	case *eth.NewBlockPacket:
+		pluginNewBlock(peer.ID(), packet.Block.Hash(), packet.Block.NumberU64(), packet.TD)
 		return h.handleBlockBroadcast(peer, packet.Block, packet.TD)
 
 	case *eth.NewPooledTransactionHashesPacket:
+		pluginNewPooledTransactionHashes(peer.ID(), *packet)
 		return h.txFetcher.Notify(peer.ID(), *packet)
 
 	case *eth.TransactionsPacket:
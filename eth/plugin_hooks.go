@@ -0,0 +1,90 @@
+package eth
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/plugins"
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+// PluginNewPooledTransactionHashes notifies plugins of transaction hashes
+// announced by the peer with the given ID.
+func PluginNewPooledTransactionHashes(pl *plugins.PluginLoader, peer string, hashes []common.Hash) {
+	fnList := pl.Lookup("NewPooledTransactionHashes", func(item interface{}) bool {
+		_, ok := item.(func(string, []core.Hash))
+		return ok
+	})
+	if len(fnList) == 0 {
+		return
+	}
+	pluginHashes := make([]core.Hash, len(hashes))
+	for i, hash := range hashes {
+		pluginHashes[i] = core.Hash(hash)
+	}
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(string, []core.Hash)); ok {
+			fn(peer, pluginHashes)
+		}
+	}
+}
+
+func pluginNewPooledTransactionHashes(peer string, hashes []common.Hash) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting NewPooledTransactionHashes, but default PluginLoader has not been initialized")
+		return
+	}
+	PluginNewPooledTransactionHashes(plugins.DefaultPluginLoader, peer, hashes)
+}
+
+// PluginNewBlockHashes notifies plugins of block hashes and numbers announced
+// by the peer with the given ID.
+func PluginNewBlockHashes(pl *plugins.PluginLoader, peer string, hashes []common.Hash, numbers []uint64) {
+	fnList := pl.Lookup("NewBlockHashes", func(item interface{}) bool {
+		_, ok := item.(func(string, []core.Hash, []uint64))
+		return ok
+	})
+	if len(fnList) == 0 {
+		return
+	}
+	pluginHashes := make([]core.Hash, len(hashes))
+	for i, hash := range hashes {
+		pluginHashes[i] = core.Hash(hash)
+	}
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(string, []core.Hash, []uint64)); ok {
+			fn(peer, pluginHashes, numbers)
+		}
+	}
+}
+
+func pluginNewBlockHashes(peer string, hashes []common.Hash, numbers []uint64) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting NewBlockHashes, but default PluginLoader has not been initialized")
+		return
+	}
+	PluginNewBlockHashes(plugins.DefaultPluginLoader, peer, hashes, numbers)
+}
+
+// PluginNewBlock notifies plugins of a block propagated by the peer with the
+// given ID, along with the total difficulty the peer claims for it.
+func PluginNewBlock(pl *plugins.PluginLoader, peer string, hash common.Hash, number uint64, td *big.Int) {
+	fnList := pl.Lookup("NewBlock", func(item interface{}) bool {
+		_, ok := item.(func(string, core.Hash, uint64, *big.Int))
+		return ok
+	})
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(string, core.Hash, uint64, *big.Int)); ok {
+			fn(peer, core.Hash(hash), number, new(big.Int).Set(td))
+		}
+	}
+}
+
+func pluginNewBlock(peer string, hash common.Hash, number uint64, td *big.Int) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting NewBlock, but default PluginLoader has not been initialized")
+		return
+	}
+	PluginNewBlock(plugins.DefaultPluginLoader, peer, hash, number, td)
+}
@@ -0,0 +1,62 @@
+package snap
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/plugins"
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+// Phases of a snap sync reported to plugins.
+const (
+	phaseAccounts = "accounts" // Account ranges are being retrieved
+	phaseStorage  = "storage"  // Accounts are retrieved, storage and bytecodes are pending
+	phaseHealing  = "healing"  // The snapshot is retrieved, the state trie is being healed
+	phaseComplete = "complete" // The state of the root is complete
+)
+
+// PluginSnapSyncPhase notifies plugins of the snap sync entering a phase,
+// along with the state root being synced.
+func PluginSnapSyncPhase(pl *plugins.PluginLoader, phase string, root common.Hash) {
+	fnList := pl.Lookup("SnapSyncPhase", func(item interface{}) bool {
+		_, ok := item.(func(string, core.Hash))
+		return ok
+	})
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(string, core.Hash)); ok {
+			fn(phase, core.Hash(root))
+		}
+	}
+}
+
+func pluginSnapSyncPhase(phase string, root common.Hash) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting SnapSyncPhase, but default PluginLoader has not been initialized")
+		return
+	}
+	PluginSnapSyncPhase(plugins.DefaultPluginLoader, phase, root)
+}
+
+// reportPhase notifies plugins if the sync entered a new phase. Phases only
+// move forward during the sync of a root: the account range of a task is
+// retrieved once its final response arrived, which is held until the storage
+// and bytecodes of its accounts are retrieved and the task is removed.
+func (s *Syncer) reportPhase() {
+	phase := phaseHealing
+	switch {
+	case len(s.tasks) == 0 && s.healer.scheduler.Pending() == 0:
+		phase = phaseComplete
+	case len(s.tasks) > 0:
+		phase = phaseStorage
+		for _, task := range s.tasks {
+			if !task.done && (task.res == nil || task.res.cont) {
+				phase = phaseAccounts
+				break
+			}
+		}
+	}
+	if phase != s.phase {
+		s.phase = phase
+		pluginSnapSyncPhase(phase, s.root)
+	}
+}
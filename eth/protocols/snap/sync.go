@@ -397,6 +397,7 @@ type Syncer struct {
 	root    common.Hash    // Current state trie root being synced
 	tasks   []*accountTask // Current account task set being synced
 	snapped bool           // Flag to signal that snap phase is done
+	phase   string         // Sync phase last reported to plugins
 	healer  *healTask      // Current state healing task being executed
 	update  chan struct{}  // Notification channel for possible sync progression
 
@@ -548,6 +549,9 @@ func (s *Syncer) Sync(root common.Hash, cancel chan struct{}) error {
 	// Move the trie root from any previous value, revert stateless markers for
 	// any peers and initialize the syncer if it was not yet run
 	s.lock.Lock()
+	if root != s.root {
+		s.phase = "" // Phases are reported anew for the new root
+	}
 	s.root = root
 	s.healer = &healTask{
 		scheduler: state.NewStateSync(root, s.db, s.onHealState),
@@ -624,6 +628,7 @@ func (s *Syncer) Sync(root common.Hash, cancel chan struct{}) error {
 		// Remove all completed tasks and terminate sync if everything's done
 		s.cleanStorageTasks()
 		s.cleanAccountTasks()
+		s.reportPhase()
 		if len(s.tasks) == 0 && s.healer.scheduler.Pending() == 0 {
 			return nil
 		}
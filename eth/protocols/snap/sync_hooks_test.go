@@ -0,0 +1,83 @@
+package snap
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/plugins"
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+func TestSyncPhaseHook(t *testing.T) {
+	var (
+		once   sync.Once
+		cancel = make(chan struct{})
+		term   = func() {
+			once.Do(func() {
+				close(cancel)
+			})
+		}
+		phases []string
+		roots  = make(map[core.Hash]bool)
+	)
+	old := plugins.DefaultPluginLoader
+	plugins.DefaultPluginLoader = &plugins.PluginLoader{
+		LookupCache: map[string][]interface{}{
+			"SnapSyncPhase": {func(phase string, root core.Hash) {
+				phases = append(phases, phase)
+				roots[root] = true
+			}},
+		},
+	}
+	defer func() { plugins.DefaultPluginLoader = old }()
+
+	sourceAccountTrie, elems, storageTries, storageElems := makeAccountTrieWithStorage(3, 3000, true, false)
+	source := newTestPeer("source", t, term)
+	source.accountTrie = sourceAccountTrie
+	source.accountValues = elems
+	source.storageTries = storageTries
+	source.storageValues = storageElems
+
+	syncer := setupSyncer(source)
+	done := checkStall(t, term)
+	if err := syncer.Sync(sourceAccountTrie.Hash(), cancel); err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	close(done)
+
+	if len(phases) < 2 || phases[0] != phaseAccounts || phases[len(phases)-1] != phaseComplete {
+		t.Errorf("Unexpected sync phases %v", phases)
+	}
+	order := map[string]int{phaseAccounts: 0, phaseStorage: 1, phaseHealing: 2, phaseComplete: 3}
+	for i := 1; i < len(phases); i++ {
+		if order[phases[i]] <= order[phases[i-1]] {
+			t.Errorf("Expected sync phases to only move forward, got %v", phases)
+			break
+		}
+	}
+	if len(roots) != 1 || !roots[core.Hash(sourceAccountTrie.Hash())] {
+		t.Errorf("Unexpected sync roots %v", roots)
+	}
+}
+
+func TestSyncPhaseForwardOnly(t *testing.T) {
+	var phases []string
+	done := plugins.HookTester("SnapSyncPhase", func(phase string, root core.Hash) {
+		phases = append(phases, phase)
+	})
+	defer done()
+
+	task := new(accountTask)
+	syncer := &Syncer{tasks: []*accountTask{task}}
+	for _, res := range []*accountResponse{
+		{cont: true},  // Range delivered, storage of its accounts pending
+		nil,           // Range forwarded, more accounts to retrieve
+		{cont: false}, // Final range delivered, storage of its accounts pending
+	} {
+		task.res = res
+		syncer.reportPhase()
+	}
+	if len(phases) != 2 || phases[0] != phaseAccounts || phases[1] != phaseStorage {
+		t.Errorf("Unexpected sync phases %v", phases)
+	}
+}
@@ -141,6 +141,15 @@ web3._extend({
 			call: 'admin_removeTrustedPeer',
 			params: 1
 		}),
+		new web3._extend.Method({
+			name: 'reloadPlugins',
+			call: 'admin_reloadPlugins',
+		}),
+		new web3._extend.Method({
+			name: 'loadPlugin',
+			call: 'admin_loadPlugin',
+			params: 1
+		}),
 		new web3._extend.Method({
 			name: 'exportChain',
 			call: 'admin_exportChain',
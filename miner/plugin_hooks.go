@@ -0,0 +1,184 @@
+package miner
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/plugins"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+// PluginOrderTransactions lets plugins select and order the transactions of a
+// block. Each hook receives the binary encoded pending transactions of local
+// and remote accounts, the base fee and the gas limit of the block, and
+// returns a sequence of bundles. The transactions of a bundle are included
+// together or not at all. The first plugin returning a non-nil sequence
+// decides; if none does, ok is false and the default ordering applies.
+func PluginOrderTransactions(pl *plugins.PluginLoader, locals, remotes map[common.Address]types.Transactions, baseFee *big.Int, gasLimit uint64) (bundles []types.Transactions, ok bool) {
+	fnList := pl.Lookup("OrderTransactions", func(item interface{}) bool {
+		_, ok := item.(func(map[core.Address][][]byte, map[core.Address][][]byte, *big.Int, uint64) [][][]byte)
+		return ok
+	})
+	if len(fnList) == 0 {
+		return nil, false
+	}
+	encLocals, encRemotes := encodePending(locals), encodePending(remotes)
+	for _, fni := range fnList {
+		fn, ok := fni.(func(map[core.Address][][]byte, map[core.Address][][]byte, *big.Int, uint64) [][][]byte)
+		if !ok {
+			continue
+		}
+		var fee *big.Int
+		if baseFee != nil {
+			fee = new(big.Int).Set(baseFee)
+		}
+		result := fn(encLocals, encRemotes, fee, gasLimit)
+		if result == nil {
+			continue
+		}
+		bundles = make([]types.Transactions, 0, len(result))
+		for _, encBundle := range result {
+			bundle := make(types.Transactions, 0, len(encBundle))
+			for _, txBytes := range encBundle {
+				tx := new(types.Transaction)
+				if err := tx.UnmarshalBinary(txBytes); err != nil {
+					log.Warn("Could not decode plugin ordered transaction, bundle discarded", "err", err)
+					bundle = nil
+					break
+				}
+				bundle = append(bundle, tx)
+			}
+			if len(bundle) > 0 {
+				bundles = append(bundles, bundle)
+			}
+		}
+		return bundles, true
+	}
+	return nil, false
+}
+
+func pluginOrderTransactions(locals, remotes map[common.Address]types.Transactions, baseFee *big.Int, gasLimit uint64) ([]types.Transactions, bool) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting OrderTransactions, but default PluginLoader has not been initialized")
+		return nil, false
+	}
+	return PluginOrderTransactions(plugins.DefaultPluginLoader, locals, remotes, baseFee, gasLimit)
+}
+
+func encodePending(pending map[common.Address]types.Transactions) map[core.Address][][]byte {
+	result := make(map[core.Address][][]byte, len(pending))
+	for addr, txs := range pending {
+		encoded := make([][]byte, 0, len(txs))
+		for _, tx := range txs {
+			txBytes, _ := tx.MarshalBinary()
+			encoded = append(encoded, txBytes)
+		}
+		result[core.Address(addr)] = encoded
+	}
+	return result
+}
+
+// PluginPayloadFeeRecipient lets plugins choose the fee recipient of a payload
+// built for the beacon chain. Each hook receives the fee recipient requested
+// by the consensus client, or the one chosen by the preceding plugin, and
+// returns the address to use.
+func PluginPayloadFeeRecipient(pl *plugins.PluginLoader, parent common.Hash, timestamp uint64, random common.Hash, feeRecipient common.Address) common.Address {
+	fnList := pl.Lookup("PayloadFeeRecipient", func(item interface{}) bool {
+		_, ok := item.(func(core.Hash, uint64, core.Hash, core.Address) core.Address)
+		return ok
+	})
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(core.Hash, uint64, core.Hash, core.Address) core.Address); ok {
+			feeRecipient = common.Address(fn(core.Hash(parent), timestamp, core.Hash(random), core.Address(feeRecipient)))
+		}
+	}
+	return feeRecipient
+}
+
+func pluginPayloadFeeRecipient(parent common.Hash, timestamp uint64, random common.Hash, feeRecipient common.Address) common.Address {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting PayloadFeeRecipient, but default PluginLoader has not been initialized")
+		return feeRecipient
+	}
+	return PluginPayloadFeeRecipient(plugins.DefaultPluginLoader, parent, timestamp, random, feeRecipient)
+}
+
+// PluginPayloadTransactions collects the binary encoded transactions plugins
+// want included at the top of a payload, ahead of the transactions of the
+// pool. The transactions of each plugin form a bundle, included together or
+// not at all.
+func PluginPayloadTransactions(pl *plugins.PluginLoader, header *types.Header) []types.Transactions {
+	fnList := pl.Lookup("PayloadTransactions", func(item interface{}) bool {
+		_, ok := item.(func(core.Hash, uint64, uint64, core.Address) [][]byte)
+		return ok
+	})
+	var bundles []types.Transactions
+	for _, fni := range fnList {
+		fn, ok := fni.(func(core.Hash, uint64, uint64, core.Address) [][]byte)
+		if !ok {
+			continue
+		}
+		var bundle types.Transactions
+		for _, txBytes := range fn(core.Hash(header.ParentHash), header.Number.Uint64(), header.Time, core.Address(header.Coinbase)) {
+			tx := new(types.Transaction)
+			if err := tx.UnmarshalBinary(txBytes); err != nil {
+				log.Warn("Could not decode plugin payload transaction, bundle discarded", "err", err)
+				bundle = nil
+				break
+			}
+			bundle = append(bundle, tx)
+		}
+		if len(bundle) > 0 {
+			bundles = append(bundles, bundle)
+		}
+	}
+	return bundles
+}
+
+func pluginPayloadTransactions(header *types.Header) []types.Transactions {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting PayloadTransactions, but default PluginLoader has not been initialized")
+		return nil
+	}
+	return PluginPayloadTransactions(plugins.DefaultPluginLoader, header)
+}
+
+// PluginPayloadBuilt notifies plugins of a payload built for the beacon chain,
+// along with its value: the priority fees paid to the fee recipient.
+func PluginPayloadBuilt(pl *plugins.PluginLoader, block *types.Block, receipts []*types.Receipt) {
+	fnList := pl.Lookup("PayloadBuilt", func(item interface{}) bool {
+		_, ok := item.(func(core.Hash, []byte, *big.Int))
+		return ok
+	})
+	if len(fnList) == 0 {
+		return
+	}
+	encoded, _ := rlp.EncodeToBytes(block)
+	value := payloadValue(block, receipts)
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(core.Hash, []byte, *big.Int)); ok {
+			fn(core.Hash(block.Hash()), encoded, new(big.Int).Set(value))
+		}
+	}
+}
+
+func pluginPayloadBuilt(block *types.Block, receipts []*types.Receipt) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting PayloadBuilt, but default PluginLoader has not been initialized")
+		return
+	}
+	PluginPayloadBuilt(plugins.DefaultPluginLoader, block, receipts)
+}
+
+// payloadValue returns the priority fees the transactions of block pay.
+func payloadValue(block *types.Block, receipts []*types.Receipt) *big.Int {
+	value := new(big.Int)
+	for i, tx := range block.Transactions() {
+		tip := tx.EffectiveGasTipValue(block.BaseFee())
+		value.Add(value, tip.Mul(tip, new(big.Int).SetUint64(receipts[i].GasUsed)))
+	}
+	return value
+}
@@ -844,26 +844,8 @@ func (w *worker) commitTransactions(env *environment, txs *types.TransactionsByP
 	var coalescedLogs []*types.Log
 
 	for {
-		// In the following three cases, we will interrupt the execution of the transaction.
-		// (1) new head block event arrival, the interrupt signal is 1
-		// (2) worker start or restart, the interrupt signal is 1
-		// (3) worker recreate the sealing block with any newly arrived transactions, the interrupt signal is 2.
-		// For the first two cases, the semi-finished work will be discarded.
-		// For the third case, the semi-finished work will be submitted to the consensus engine.
-		if interrupt != nil && atomic.LoadInt32(interrupt) != commitInterruptNone {
-			// Notify resubmit loop to increase resubmitting interval due to too frequent commits.
-			if atomic.LoadInt32(interrupt) == commitInterruptResubmit {
-				ratio := float64(gasLimit-env.gasPool.Gas()) / float64(gasLimit)
-				if ratio < 0.1 {
-					ratio = 0.1
-				}
-				w.resubmitAdjustCh <- &intervalAdjust{
-					ratio: ratio,
-					inc:   true,
-				}
-				return errBlockInterruptedByRecommit
-			}
-			return errBlockInterruptedByNewHead
+		if err := w.checkInterrupt(env, interrupt); err != nil {
+			return err
 		}
 		// If we don't have enough gas for any further transactions then we're done
 		if env.gasPool.Gas() < params.TxGas {
@@ -927,6 +909,151 @@ func (w *worker) commitTransactions(env *environment, txs *types.TransactionsByP
 		}
 	}
 
+	w.commitLogs(coalescedLogs, interrupt)
+	return nil
+}
+
+// commitBundles commits the plugin ordered bundles of transactions. A bundle
+// whose transactions cannot all be included is discarded as a whole, leaving
+// the environment as it was before the bundle was attempted.
+func (w *worker) commitBundles(env *environment, bundles []types.Transactions, interrupt *int32) error {
+	if env.gasPool == nil {
+		env.gasPool = new(core.GasPool).AddGas(env.header.GasLimit)
+	}
+	var (
+		coalescedLogs []*types.Log
+		base          *bundleBase
+	)
+	for _, bundle := range bundles {
+		if err := w.checkInterrupt(env, interrupt); err != nil {
+			return err
+		}
+		// If we don't have enough gas for any further transactions then we're done
+		if env.gasPool.Gas() < params.TxGas {
+			log.Trace("Not enough gas for further transactions", "have", env.gasPool, "want", params.TxGas)
+			break
+		}
+		// A failing transaction is reverted by commitTransaction. Transactions
+		// are finalised as they are applied though, which invalidates the state
+		// snapshots taken before them, so the transactions of a bundle preceding
+		// a failing one are reverted by rebuilding the state from a copy, taken
+		// before the first bundle of several transactions.
+		if base == nil && len(bundle) > 1 {
+			base = newBundleBase(env)
+		}
+		var (
+			gas      = env.gasPool.Gas()
+			gasUsed  = env.header.GasUsed
+			tcount   = env.tcount
+			ntxs     = len(env.txs)
+			included []*types.Log
+			err      error
+		)
+		for _, tx := range bundle {
+			if tx.Protected() && !w.chainConfig.IsEIP155(env.header.Number) {
+				err = types.ErrInvalidChainId
+			} else {
+				var logs []*types.Log
+				env.state.Prepare(tx.Hash(), env.tcount)
+				logs, err = w.commitTransaction(env, tx)
+				included = append(included, logs...)
+			}
+			if err != nil {
+				log.Debug("Plugin bundle discarded", "hash", tx.Hash(), "size", len(bundle), "err", err)
+				break
+			}
+			env.tcount++
+		}
+		if err != nil {
+			if len(env.txs) > ntxs {
+				if err := w.revertBundle(env, base, ntxs); err != nil {
+					return err
+				}
+			}
+			*env.gasPool = core.GasPool(gas)
+			env.header.GasUsed = gasUsed
+			env.tcount = tcount
+			env.txs, env.receipts = env.txs[:ntxs], env.receipts[:ntxs]
+			continue
+		}
+		coalescedLogs = append(coalescedLogs, included...)
+	}
+	w.commitLogs(coalescedLogs, interrupt)
+	return nil
+}
+
+// bundleBase is the environment bundles are reverted from.
+type bundleBase struct {
+	state   *state.StateDB
+	gas     uint64
+	gasUsed uint64
+	tcount  int
+	ntxs    int
+}
+
+func newBundleBase(env *environment) *bundleBase {
+	return &bundleBase{
+		state:   env.state.Copy(),
+		gas:     env.gasPool.Gas(),
+		gasUsed: env.header.GasUsed,
+		tcount:  env.tcount,
+		ntxs:    len(env.txs),
+	}
+}
+
+// revertBundle rewinds the environment to base, and commits again the
+// transactions included since, up to the first ntxs transactions of env.
+func (w *worker) revertBundle(env *environment, base *bundleBase, ntxs int) error {
+	txs := make(types.Transactions, ntxs-base.ntxs)
+	copy(txs, env.txs[base.ntxs:ntxs])
+
+	env.state.StopPrefetcher()
+	env.state = base.state.Copy()
+	*env.gasPool = core.GasPool(base.gas)
+	env.header.GasUsed = base.gasUsed
+	env.tcount = base.tcount
+	env.txs, env.receipts = env.txs[:base.ntxs], env.receipts[:base.ntxs]
+	for _, tx := range txs {
+		env.state.Prepare(tx.Hash(), env.tcount)
+		if _, err := w.commitTransaction(env, tx); err != nil {
+			return fmt.Errorf("failed to revert plugin bundle: %v", err)
+		}
+		env.tcount++
+	}
+	return nil
+}
+
+// checkInterrupt returns the error aborting the transaction commit if the
+// interrupt signal is set.
+func (w *worker) checkInterrupt(env *environment, interrupt *int32) error {
+	// In the following three cases, we will interrupt the execution of the transaction.
+	// (1) new head block event arrival, the interrupt signal is 1
+	// (2) worker start or restart, the interrupt signal is 1
+	// (3) worker recreate the sealing block with any newly arrived transactions, the interrupt signal is 2.
+	// For the first two cases, the semi-finished work will be discarded.
+	// For the third case, the semi-finished work will be submitted to the consensus engine.
+	if interrupt != nil && atomic.LoadInt32(interrupt) != commitInterruptNone {
+		// Notify resubmit loop to increase resubmitting interval due to too frequent commits.
+		if atomic.LoadInt32(interrupt) == commitInterruptResubmit {
+			gasLimit := env.header.GasLimit
+			ratio := float64(gasLimit-env.gasPool.Gas()) / float64(gasLimit)
+			if ratio < 0.1 {
+				ratio = 0.1
+			}
+			w.resubmitAdjustCh <- &intervalAdjust{
+				ratio: ratio,
+				inc:   true,
+			}
+			return errBlockInterruptedByRecommit
+		}
+		return errBlockInterruptedByNewHead
+	}
+	return nil
+}
+
+// commitLogs publishes the logs of the committed transactions as pending logs
+// and notifies the resubmit loop once the transactions are committed.
+func (w *worker) commitLogs(coalescedLogs []*types.Log, interrupt *int32) {
 	if !w.isRunning() && len(coalescedLogs) > 0 {
 		// We don't push the pendingLogsEvent while we are sealing. The reason is that
 		// when we are sealing, the worker will regenerate a sealing block every 3 seconds.
@@ -947,7 +1074,6 @@ func (w *worker) commitTransactions(env *environment, txs *types.TransactionsByP
 	if interrupt != nil {
 		w.resubmitAdjustCh <- &intervalAdjust{inc: false}
 	}
-	return nil
 }
 
 // generateParams wraps various of settings for generating sealing task.
@@ -1046,7 +1172,7 @@ func (w *worker) prepareWork(genParams *generateParams) (*environment, error) {
 
 // fillTransactions retrieves the pending transactions from the txpool and fills them
 // into the given sealing block. The transaction selection and ordering strategy can
-// be customized with the plugin in the future.
+// be customized with the OrderTransactions plugin hook.
 func (w *worker) fillTransactions(interrupt *int32, env *environment) error {
 	// Split the pending transactions into locals and remotes
 	// Fill the block with all available pending transactions.
@@ -1058,6 +1184,9 @@ func (w *worker) fillTransactions(interrupt *int32, env *environment) error {
 			localTxs[account] = txs
 		}
 	}
+	if bundles, ok := pluginOrderTransactions(localTxs, remoteTxs, env.header.BaseFee, env.header.GasLimit); ok {
+		return w.commitBundles(env, bundles, interrupt)
+	}
 	if len(localTxs) > 0 {
 		txs := types.NewTransactionsByPriceAndNonce(env.signer, localTxs, env.header.BaseFee)
 		if err := w.commitTransactions(env, txs, interrupt); err != nil {
@@ -1075,6 +1204,7 @@ func (w *worker) fillTransactions(interrupt *int32, env *environment) error {
 
 // generateWork generates a sealing block based on the given parameters.
 func (w *worker) generateWork(params *generateParams) (*types.Block, error) {
+	params.coinbase = pluginPayloadFeeRecipient(params.parentHash, params.timestamp, params.random, params.coinbase)
 	work, err := w.prepareWork(params)
 	if err != nil {
 		return nil, err
@@ -1082,9 +1212,15 @@ func (w *worker) generateWork(params *generateParams) (*types.Block, error) {
 	defer work.discard()
 
 	if !params.noTxs {
+		w.commitBundles(work, pluginPayloadTransactions(work.header), nil)
 		w.fillTransactions(nil, work)
 	}
-	return w.engine.FinalizeAndAssemble(w.chain, work.header, work.state, work.txs, work.unclelist(), work.receipts)
+	block, err := w.engine.FinalizeAndAssemble(w.chain, work.header, work.state, work.txs, work.unclelist(), work.receipts)
+	if err != nil {
+		return nil, err
+	}
+	pluginPayloadBuilt(block, work.receipts)
+	return block, nil
 }
 
 // commitWork generates several new sealing tasks based on the parent block
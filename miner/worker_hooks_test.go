@@ -0,0 +1,156 @@
+package miner
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/plugins"
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+func TestOrderTransactionsHook(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	w, b := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+	b.txPool.AddLocals(newTxs)
+
+	var (
+		tx0, _ = pendingTxs[0].MarshalBinary()
+		tx1, _ = newTxs[0].MarshalBinary()
+		tx2, _ = types.MustSignNewTx(testBankKey, types.LatestSigner(ethashChainConfig), &types.LegacyTx{
+			Nonce:    2,
+			To:       &testUserAddress,
+			Value:    big.NewInt(1000),
+			Gas:      params.TxGas,
+			GasPrice: big.NewInt(params.InitialBaseFee),
+		}).MarshalBinary()
+		pending int
+		order   [][][]byte
+	)
+	old := plugins.DefaultPluginLoader
+	plugins.DefaultPluginLoader = &plugins.PluginLoader{
+		LookupCache: map[string][]interface{}{
+			"OrderTransactions": {func(locals, remotes map[core.Address][][]byte, baseFee *big.Int, gasLimit uint64) [][][]byte {
+				pending = len(locals[core.Address(testBankAddress)])
+				return order
+			}},
+		},
+	}
+	defer func() { plugins.DefaultPluginLoader = old }()
+
+	fill := func() []core.Hash {
+		env, err := w.prepareWork(&generateParams{timestamp: uint64(time.Now().Unix()), coinbase: testUserAddress})
+		if err != nil {
+			t.Fatalf("Failed to prepare work: %v", err)
+		}
+		defer env.discard()
+		if err := w.fillTransactions(nil, env); err != nil {
+			t.Fatalf("Failed to fill transactions: %v", err)
+		}
+		if env.header.GasUsed != uint64(len(env.txs))*21000 || env.gasPool.Gas() != env.header.GasLimit-env.header.GasUsed {
+			t.Errorf("Unexpected gas used %d for %d transactions", env.header.GasUsed, len(env.txs))
+		}
+		if nonce := env.state.GetNonce(testBankAddress); nonce != uint64(len(env.txs)) {
+			t.Errorf("Unexpected nonce %d after %d transactions", nonce, len(env.txs))
+		}
+		var hashes []core.Hash
+		for _, tx := range env.txs {
+			hashes = append(hashes, core.Hash(tx.Hash()))
+		}
+		return hashes
+	}
+	// The last transaction of the first bundle fails, so the bundle is reverted
+	// as a whole and the transactions of the second one are included instead.
+	order = [][][]byte{{tx0, tx1, tx1}, {tx0, tx1}}
+	if hashes := fill(); len(hashes) != 2 || hashes[0] != core.Hash(pendingTxs[0].Hash()) || hashes[1] != core.Hash(newTxs[0].Hash()) {
+		t.Errorf("Unexpected plugin ordered transactions %x", hashes)
+	}
+	if pending != 2 {
+		t.Errorf("Expected plugin to receive 2 pending local transactions, got %d", pending)
+	}
+	// Bundles included before a reverted one are kept
+	order = [][][]byte{{tx0, tx1}, {tx2, tx2}, {tx2}}
+	if hashes := fill(); len(hashes) != 3 || hashes[2] != core.Hash(crypto.Keccak256Hash(tx2)) {
+		t.Errorf("Unexpected plugin ordered transactions %x", hashes)
+	}
+	order = [][][]byte{}
+	if hashes := fill(); len(hashes) != 0 {
+		t.Errorf("Expected empty plugin ordering to leave the block empty, got %x", hashes)
+	}
+	order = nil
+	if hashes := fill(); len(hashes) != 2 {
+		t.Errorf("Expected default ordering to include 2 transactions, got %d", len(hashes))
+	}
+}
+
+func TestPayloadHooks(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	w, _ := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+
+	var (
+		recipient = common.Address{0x01}
+		gasPrice  = big.NewInt(10 * params.InitialBaseFee)
+		injected  = types.MustSignNewTx(testBankKey, types.LatestSigner(ethashChainConfig), &types.LegacyTx{
+			Nonce:    0,
+			To:       &recipient,
+			Gas:      params.TxGas,
+			GasPrice: gasPrice,
+		})
+		built common.Hash
+		value *big.Int
+	)
+	old := plugins.DefaultPluginLoader
+	plugins.DefaultPluginLoader = &plugins.PluginLoader{
+		LookupCache: map[string][]interface{}{
+			"PayloadFeeRecipient": {func(parent core.Hash, timestamp uint64, random core.Hash, feeRecipient core.Address) core.Address {
+				return core.Address(recipient)
+			}},
+			"PayloadTransactions": {func(parent core.Hash, number, timestamp uint64, feeRecipient core.Address) [][]byte {
+				if feeRecipient != core.Address(recipient) {
+					t.Errorf("Unexpected fee recipient %x", feeRecipient)
+				}
+				txBytes, _ := injected.MarshalBinary()
+				return [][]byte{txBytes}
+			}},
+			"PayloadBuilt": {func(hash core.Hash, block []byte, v *big.Int) {
+				built, value = common.Hash(hash), v
+			}},
+		},
+	}
+	defer func() { plugins.DefaultPluginLoader = old }()
+
+	resCh, errCh, err := w.getSealingBlock(w.chain.CurrentBlock().Hash(), uint64(time.Now().Unix()), testUserAddress, common.Hash{}, false)
+	if err != nil {
+		t.Fatalf("Failed to request payload: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("Failed to build payload: %v", err)
+	}
+	block := <-resCh
+	if block.Coinbase() != recipient {
+		t.Errorf("Unexpected fee recipient %x, want %x", block.Coinbase(), recipient)
+	}
+	// The pool transaction of the same nonce is skipped.
+	if txs := block.Transactions(); len(txs) != 1 || txs[0].Hash() != injected.Hash() {
+		t.Errorf("Expected the plugin transaction at the top of the payload")
+	}
+	if built != block.Hash() {
+		t.Errorf("Expected the built payload %x to be observed, got %x", block.Hash(), built)
+	}
+	want := new(big.Int).Mul(new(big.Int).Sub(gasPrice, block.BaseFee()), big.NewInt(int64(params.TxGas)))
+	if value == nil || value.Cmp(want) != 0 {
+		t.Errorf("Unexpected payload value %v, want %v", value, want)
+	}
+}
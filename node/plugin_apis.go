@@ -0,0 +1,108 @@
+package node
+
+import (
+	"reflect"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ReplaceAPIs swaps APIs on a node that may already be running, so plugins
+// can be reloaded without a restart. The services of old are unregistered
+// from every RPC endpoint and those of apis are registered on each endpoint
+// configured to expose their namespace.
+func (n *Node) ReplaceAPIs(old, apis []rpc.API) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.state == closedState {
+		return ErrNodeStopped
+	}
+	kept := make([]rpc.API, 0, len(n.rpcAPIs))
+	for _, api := range n.rpcAPIs {
+		if !providesAPI(old, api) {
+			kept = append(kept, api)
+		}
+	}
+	n.rpcAPIs = append(kept, apis...)
+	if n.state != runningState {
+		// Endpoints are started with the registered APIs.
+		return nil
+	}
+	var open []rpc.API
+	for _, api := range apis {
+		if !api.Authenticated {
+			open = append(open, api)
+		}
+	}
+	replace := func(srv *rpc.Server, apis []rpc.API, modules []string) error {
+		for _, api := range old {
+			srv.UnregisterName(api.Namespace, api.Service)
+		}
+		allowList := make(map[string]bool)
+		for _, module := range modules {
+			allowList[module] = true
+		}
+		for _, api := range apis {
+			if allowList[api.Namespace] || len(allowList) == 0 {
+				if err := srv.RegisterName(api.Namespace, api.Service); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := replace(n.inprocHandler, apis, nil); err != nil {
+		return err
+	}
+	n.ipc.mu.Lock()
+	srv := n.ipc.srv
+	n.ipc.mu.Unlock()
+	if srv != nil {
+		if err := replace(srv, apis, nil); err != nil {
+			return err
+		}
+	}
+	seen := make(map[*httpServer]bool)
+	for _, h := range []*httpServer{n.http, n.ws, n.httpAuth, n.wsAuth} {
+		if seen[h] {
+			continue
+		}
+		seen[h] = true
+		authenticated := h == n.httpAuth || h == n.wsAuth
+		h.mu.Lock()
+		httpModules, wsModules := h.httpConfig.Modules, h.wsConfig.Modules
+		h.mu.Unlock()
+		if handler := h.httpHandler.Load().(*rpcHandler); handler != nil {
+			set := open
+			if authenticated {
+				set = apis
+			}
+			if err := replace(handler.server, set, httpModules); err != nil {
+				return err
+			}
+		}
+		if handler := h.wsHandler.Load().(*rpcHandler); handler != nil {
+			set := open
+			if h == n.wsAuth {
+				set = apis
+			}
+			if err := replace(handler.server, set, wsModules); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// providesAPI reports whether apis holds the service of api.
+func providesAPI(apis []rpc.API, api rpc.API) bool {
+	for _, a := range apis {
+		if a.Namespace != api.Namespace || reflect.TypeOf(a.Service) != reflect.TypeOf(api.Service) {
+			continue
+		}
+		if reflect.TypeOf(a.Service).Comparable() && a.Service == api.Service {
+			return true
+		}
+	}
+	return false
+}
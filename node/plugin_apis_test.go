@@ -0,0 +1,71 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+type reloadService struct{ version int }
+
+func (s *reloadService) Version() int { return s.version }
+
+func TestReplaceAPIs(t *testing.T) {
+	stack := startHTTP(t, 0, 0)
+	defer stack.Close()
+
+	check := func(expected int) {
+		t.Helper()
+		inproc, _ := stack.Attach()
+		defer inproc.Close()
+		remote, err := rpc.Dial(stack.HTTPEndpoint())
+		if err != nil {
+			t.Fatalf("could not dial http endpoint: %v", err)
+		}
+		defer remote.Close()
+		for _, client := range []*rpc.Client{inproc, remote} {
+			var version int
+			err := client.Call(&version, "reload_version")
+			switch {
+			case expected == 0 && err == nil:
+				t.Errorf("expected reload_version to be unavailable")
+			case expected != 0 && (err != nil || version != expected):
+				t.Errorf("expected version %d, got %d (%v)", expected, version, err)
+			}
+		}
+	}
+	v1 := []rpc.API{{Namespace: "reload", Service: &reloadService{1}}}
+	v2 := []rpc.API{{Namespace: "reload", Service: &reloadService{2}}}
+	if err := stack.ReplaceAPIs(nil, v1); err != nil {
+		t.Fatal(err)
+	}
+	check(1)
+	if err := stack.ReplaceAPIs(v1, v2); err != nil {
+		t.Fatal(err)
+	}
+	check(2)
+	if err := stack.ReplaceAPIs(v2, nil); err != nil {
+		t.Fatal(err)
+	}
+	check(0)
+	if _, all := stack.GetAPIs(); containsAPI(all, v2[0]) {
+		t.Errorf("expected replaced API to be removed from the node")
+	}
+
+	// Authenticated APIs are not served on the public endpoints
+	auth := []rpc.API{{Namespace: "reload", Service: &reloadService{3}, Authenticated: true}}
+	if err := stack.ReplaceAPIs(nil, auth); err != nil {
+		t.Fatal(err)
+	}
+	for _, endpoint := range []string{stack.HTTPEndpoint(), stack.WSEndpoint()} {
+		client, err := rpc.Dial(endpoint)
+		if err != nil {
+			t.Fatalf("could not dial %v: %v", endpoint, err)
+		}
+		var version int
+		if err := client.Call(&version, "reload_version"); err == nil {
+			t.Errorf("expected authenticated API to be unavailable on %v", endpoint)
+		}
+		client.Close()
+	}
+}
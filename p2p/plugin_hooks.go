@@ -0,0 +1,177 @@
+package p2p
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/plugins"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// trustedPeersInterval is the interval at which plugins are asked for the
+// peers to trust.
+var trustedPeersInterval = time.Minute
+
+// PluginPeerConnected notifies plugins of a peer that passed the protocol
+// handshake. The hooks receive the node ID, the enode URL, the RLP encoded
+// node record, the capabilities (such as "eth/66") and the direction of the
+// connection.
+func PluginPeerConnected(pl *plugins.PluginLoader, p *Peer) {
+	fnList := pl.Lookup("PeerConnected", func(item interface{}) bool {
+		_, ok := item.(func(string, string, []byte, []string, bool))
+		return ok
+	})
+	if len(fnList) == 0 {
+		return
+	}
+	enr, _ := rlp.EncodeToBytes(p.Node().Record())
+	caps := make([]string, 0, len(p.Caps()))
+	for _, c := range p.Caps() {
+		caps = append(caps, c.String())
+	}
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(string, string, []byte, []string, bool)); ok {
+			fn(p.ID().String(), p.Node().URLv4(), enr, caps, p.Inbound())
+		}
+	}
+}
+
+func pluginPeerConnected(p *Peer) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting PeerConnected, but default PluginLoader has not been initialized")
+		return
+	}
+	PluginPeerConnected(plugins.DefaultPluginLoader, p)
+}
+
+// PluginPeerDisconnected notifies plugins of a peer that disconnected, with
+// the reason of the disconnect and how long the peer was connected.
+func PluginPeerDisconnected(pl *plugins.PluginLoader, p *Peer, err error) {
+	fnList := pl.Lookup("PeerDisconnected", func(item interface{}) bool {
+		_, ok := item.(func(string, string, bool, string, time.Duration))
+		return ok
+	})
+	var reason string
+	if err != nil {
+		reason = err.Error()
+	}
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(string, string, bool, string, time.Duration)); ok {
+			fn(p.ID().String(), p.Node().URLv4(), p.Inbound(), reason, time.Duration(mclock.Now()-p.created))
+		}
+	}
+}
+
+func pluginPeerDisconnected(p *Peer, err error) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting PeerDisconnected, but default PluginLoader has not been initialized")
+		return
+	}
+	PluginPeerDisconnected(plugins.DefaultPluginLoader, p, err)
+}
+
+// PluginPeerFilter reports whether plugins allow a peer, given its enode URL,
+// its RLP encoded node record and the direction of the connection. A peer is
+// allowed unless a plugin returns false. Faulty plugins deny the peers they
+// are asked about, as do quarantined ones. Peers are filtered once the
+// encryption handshake reveals their identity, before the protocol handshake,
+// in the goroutine setting up the connection so that slow plugins do not hold
+// up other connections.
+func PluginPeerFilter(pl *plugins.PluginLoader, node *enode.Node, inbound bool) bool {
+	fnList := pl.Lookup("PeerFilter", func(item interface{}) bool {
+		_, ok := item.(func(string, []byte, bool) bool)
+		return ok
+	})
+	if len(fnList) == 0 {
+		return true
+	}
+	enr, _ := rlp.EncodeToBytes(node.Record())
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(string, []byte, bool) bool); ok && !fn(node.URLv4(), enr, inbound) {
+			return false
+		}
+	}
+	return true
+}
+
+func pluginPeerFilter(node *enode.Node, inbound bool) bool {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting PeerFilter, but default PluginLoader has not been initialized")
+		return true
+	}
+	return PluginPeerFilter(plugins.DefaultPluginLoader, node, inbound)
+}
+
+// PluginTrustedPeers collects the peers plugins want trusted, as enode URLs
+// or node records in text form.
+func PluginTrustedPeers(pl *plugins.PluginLoader) []*enode.Node {
+	fnList := pl.Lookup("TrustedPeers", func(item interface{}) bool {
+		_, ok := item.(func() []string)
+		return ok
+	})
+	var nodes []*enode.Node
+	for _, fni := range fnList {
+		fn, ok := fni.(func() []string)
+		if !ok {
+			continue
+		}
+		for _, url := range fn() {
+			node, err := enode.Parse(enode.ValidSchemes, url)
+			if err != nil {
+				log.Warn("Invalid trusted peer from plugin", "url", url, "err", err)
+				continue
+			}
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// pluginTrustedPeers is polled whether or not plugins are loaded, so a missing
+// loader is not reported.
+func pluginTrustedPeers() []*enode.Node {
+	if plugins.DefaultPluginLoader == nil {
+		return nil
+	}
+	return PluginTrustedPeers(plugins.DefaultPluginLoader)
+}
+
+// trustedPeersLoop periodically trusts the peers returned by the TrustedPeers
+// hook, and stops trusting the ones no longer returned. Peers configured as
+// trusted stay trusted. It runs whether or not plugins are loaded as the
+// server starts, so plugins loaded later, such as by a reload, are polled from
+// the next interval.
+func (srv *Server) trustedPeersLoop() {
+	defer srv.loopWG.Done()
+	ticker := time.NewTicker(trustedPeersInterval)
+	defer ticker.Stop()
+
+	configured := make(map[enode.ID]bool, len(srv.TrustedNodes))
+	for _, n := range srv.TrustedNodes {
+		configured[n.ID()] = true
+	}
+	trusted := make(map[enode.ID]*enode.Node)
+	for {
+		current := make(map[enode.ID]*enode.Node)
+		for _, n := range pluginTrustedPeers() {
+			current[n.ID()] = n
+			if _, ok := trusted[n.ID()]; !ok {
+				srv.AddTrustedPeer(n)
+			}
+		}
+		for id, n := range trusted {
+			if _, ok := current[id]; !ok && !configured[id] {
+				srv.RemoveTrustedPeer(n)
+			}
+		}
+		trusted = current
+
+		select {
+		case <-ticker.C:
+		case <-srv.quit:
+			return
+		}
+	}
+}
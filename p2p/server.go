@@ -489,6 +489,8 @@ func (srv *Server) Start() (err error) {
 
 	srv.loopWG.Add(1)
 	go srv.run()
+	srv.loopWG.Add(1)
+	go srv.trustedPeersLoop()
 	return nil
 }
 
@@ -976,6 +978,10 @@ func (srv *Server) setupConn(c *conn, flags connFlag, dialDest *enode.Node) erro
 		c.node = nodeFromConn(remotePubkey, c.fd)
 	}
 	clog := srv.log.New("id", c.node.ID(), "addr", c.fd.RemoteAddr(), "conn", c.flags)
+	if !pluginPeerFilter(c.node, c.is(inboundConn)) {
+		clog.Trace("Rejected peer", "err", "rejected by plugin")
+		return DiscUselessPeer
+	}
 	err = srv.checkpoint(c, srv.checkpointPostHandshake)
 	if err != nil {
 		clog.Trace("Rejected peer", "err", err)
@@ -1045,6 +1051,7 @@ func (srv *Server) runPeer(p *Peer) {
 		RemoteAddress: p.RemoteAddr().String(),
 		LocalAddress:  p.LocalAddr().String(),
 	})
+	pluginPeerConnected(p)
 
 	// Run the per-peer main loop.
 	remoteRequested, err := p.run()
@@ -1053,6 +1060,7 @@ func (srv *Server) runPeer(p *Peer) {
 	// The main loop waits for existing peers to be sent on srv.delpeer
 	// before returning, so this send should not select on srv.quit.
 	srv.delpeer <- peerDrop{p, err, remoteRequested}
+	pluginPeerDisconnected(p, err)
 
 	// Broadcast peer drop to external subscribers. This needs to be
 	// after the send to delpeer so subscribers have a consistent view of
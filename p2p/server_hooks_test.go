@@ -0,0 +1,206 @@
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/internal/testlog"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/plugins"
+)
+
+func TestServerPeerHooks(t *testing.T) {
+	type event struct {
+		id, enode string
+		inbound   bool
+		reason    string
+	}
+	var (
+		connected    = make(chan event, 2)
+		disconnected = make(chan event, 2)
+	)
+	old := plugins.DefaultPluginLoader
+	plugins.DefaultPluginLoader = &plugins.PluginLoader{
+		LookupCache: map[string][]interface{}{
+			"PeerConnected": {func(id, enode string, enr []byte, caps []string, inbound bool) {
+				if len(enr) == 0 {
+					t.Errorf("Expected node record of peer %v", id)
+				}
+				connected <- event{id: id, enode: enode, inbound: inbound}
+			}},
+			"PeerDisconnected": {func(id, enode string, inbound bool, reason string, duration time.Duration) {
+				disconnected <- event{id: id, enode: enode, inbound: inbound, reason: reason}
+			}},
+		},
+	}
+	defer func() { plugins.DefaultPluginLoader = old }()
+
+	srv1 := &Server{Config: Config{
+		PrivateKey:  newkey(),
+		MaxPeers:    1,
+		NoDiscovery: true,
+		Logger:      testlog.Logger(t, log.LvlTrace).New("server", "1"),
+	}}
+	srv2 := &Server{Config: Config{
+		PrivateKey:  newkey(),
+		MaxPeers:    1,
+		NoDiscovery: true,
+		NoDial:      true,
+		ListenAddr:  "127.0.0.1:0",
+		Logger:      testlog.Logger(t, log.LvlTrace).New("server", "2"),
+	}}
+	srv1.Start()
+	defer srv1.Stop()
+	srv2.Start()
+	defer srv2.Stop()
+
+	if !syncAddPeer(srv1, srv2.Self()) {
+		t.Fatal("peer not connected")
+	}
+	srv1.RemovePeer(srv2.Self())
+
+	check := func(events chan event, kind string) {
+		seen := make(map[string]event)
+		for i := 0; i < 2; i++ {
+			select {
+			case ev := <-events:
+				seen[ev.id] = ev
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timed out waiting for %v hooks", kind)
+			}
+		}
+		if ev, ok := seen[srv2.Self().ID().String()]; !ok || ev.inbound || ev.enode != srv2.Self().URLv4() {
+			t.Errorf("Unexpected %v hook for outbound peer: %+v", kind, ev)
+		}
+		if ev, ok := seen[srv1.Self().ID().String()]; !ok || !ev.inbound {
+			t.Errorf("Unexpected %v hook for inbound peer: %+v", kind, ev)
+		}
+	}
+	check(connected, "connect")
+	check(disconnected, "disconnect")
+}
+
+func TestServerPeerFilter(t *testing.T) {
+	newServers := func() (*Server, *Server) {
+		srv1 := &Server{Config: Config{
+			PrivateKey:  newkey(),
+			MaxPeers:    1,
+			NoDiscovery: true,
+			Logger:      testlog.Logger(t, log.LvlTrace).New("server", "1"),
+		}}
+		srv2 := &Server{Config: Config{
+			PrivateKey:  newkey(),
+			MaxPeers:    1,
+			NoDiscovery: true,
+			NoDial:      true,
+			ListenAddr:  "127.0.0.1:0",
+			Logger:      testlog.Logger(t, log.LvlTrace).New("server", "2"),
+		}}
+		srv1.Start()
+		srv2.Start()
+		return srv1, srv2
+	}
+	var (
+		rejected string
+		filtered = make(chan bool, 16)
+	)
+	done := plugins.HookTester("PeerFilter", func(enode string, enr []byte, inbound bool) bool {
+		select {
+		case filtered <- inbound:
+		default:
+		}
+		return enode != rejected
+	})
+	defer done()
+
+	// Denied peers do not connect
+	srv1, srv2 := newServers()
+	rejected = srv2.Self().URLv4()
+	if syncAddPeer(srv1, srv2.Self()) {
+		t.Fatal("Expected peer denied by plugin not to connect")
+	}
+	srv1.Stop()
+	srv2.Stop()
+
+	// Both ends of a connection filter their peer
+	rejected = ""
+	for len(filtered) > 0 {
+		<-filtered
+	}
+	srv1, srv2 = newServers()
+	if !syncAddPeer(srv1, srv2.Self()) {
+		t.Fatal("Expected peer to connect")
+	}
+	srv1.Stop()
+	srv2.Stop()
+	directions := make(map[bool]bool)
+	for len(filtered) > 0 {
+		directions[<-filtered] = true
+	}
+	if !directions[true] || !directions[false] {
+		t.Errorf("Expected inbound and outbound connections to be filtered, got %v", directions)
+	}
+
+	// A faulty filter denies peers
+	done()
+	done = plugins.GuardedHookTester("PeerFilter", func(enode string, enr []byte, inbound bool) bool {
+		panic("faulty plugin")
+	})
+	srv1, srv2 = newServers()
+	defer srv1.Stop()
+	defer srv2.Stop()
+	if syncAddPeer(srv1, srv2.Self()) {
+		t.Fatal("Expected faulty filter to deny peer")
+	}
+}
+
+func TestServerTrustedPeersHook(t *testing.T) {
+	srv1 := &Server{Config: Config{
+		PrivateKey:  newkey(),
+		MaxPeers:    1,
+		NoDiscovery: true,
+		Logger:      testlog.Logger(t, log.LvlTrace).New("server", "1"),
+	}}
+	// The listening server accepts trusted peers only.
+	srv2 := &Server{Config: Config{
+		PrivateKey:  newkey(),
+		MaxPeers:    0,
+		NoDiscovery: true,
+		NoDial:      true,
+		ListenAddr:  "127.0.0.1:0",
+		Logger:      testlog.Logger(t, log.LvlTrace).New("server", "2"),
+	}}
+	var (
+		polled      = make(chan struct{}, 16)
+		oldInterval = trustedPeersInterval
+	)
+	trustedPeersInterval = 10 * time.Millisecond
+	defer func() { trustedPeersInterval = oldInterval }()
+
+	old := plugins.DefaultPluginLoader
+	plugins.DefaultPluginLoader = &plugins.PluginLoader{
+		LookupCache: map[string][]interface{}{
+			"TrustedPeers": {func() []string {
+				select {
+				case polled <- struct{}{}:
+				default:
+				}
+				return []string{srv1.Self().URLv4()}
+			}},
+		},
+	}
+	defer func() { plugins.DefaultPluginLoader = old }()
+
+	srv1.Start()
+	defer srv1.Stop()
+	srv2.Start()
+	defer srv2.Stop()
+
+	// Once the servers polled the hook a few times, the peer is trusted.
+	for i := 0; i < 6; i++ {
+		<-polled
+	}
+	if !syncAddPeer(srv1, srv2.Self()) {
+		t.Fatal("Expected peer trusted by plugin to connect")
+	}
+}
@@ -753,6 +753,7 @@ func (err *ConfigCompatError) Error() string {
 // phases.
 type Rules struct {
 	ChainID                                                 *big.Int
+	BlockNumber                                             *big.Int // Used to activate plugin precompiles
 	IsHomestead, IsEIP150, IsEIP155, IsEIP158               bool
 	IsByzantium, IsConstantinople, IsPetersburg, IsIstanbul bool
 	IsBerlin, IsLondon                                      bool
@@ -765,8 +766,13 @@ func (c *ChainConfig) Rules(num *big.Int, isMerge bool) Rules {
 	if chainID == nil {
 		chainID = new(big.Int)
 	}
+	var number *big.Int
+	if num != nil {
+		number = new(big.Int).Set(num)
+	}
 	return Rules{
 		ChainID:          new(big.Int).Set(chainID),
+		BlockNumber:      number,
 		IsHomestead:      c.IsHomestead(num),
 		IsEIP150:         c.IsEIP150(num),
 		IsEIP155:         c.IsEIP155(num),
@@ -0,0 +1,168 @@
+package plugins
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// Back-pressure policies of asynchronous hook queues.
+const (
+	// PolicyBlock makes the caller wait for space in the queue, stalling
+	// block import until the plugin catches up.
+	PolicyBlock = "block"
+	// PolicyDropOldest discards the oldest queued invocation to make room.
+	PolicyDropOldest = "drop-oldest"
+	// PolicyHalt stops delivering hooks to the plugin once its queue is full,
+	// for plugins that must not miss data and would rather be reloaded, and
+	// have the blocks missed replayed, than stall import. The plugin receives
+	// no invocation past the first one that did not fit in the queue.
+	PolicyHalt = "halt"
+)
+
+const defaultQueueSize = 128
+
+// defaultAsyncHooks are delivered asynchronously if a plugin opts in without
+// listing hooks.
+var defaultAsyncHooks = []string{"NewHead", "NewSideBlock", "Reorg", "StateUpdate"}
+
+// AsyncConfig opts a plugin into asynchronous hook delivery. Invocations of
+// the listed hooks are queued and run on a goroutine dedicated to the plugin,
+// in the order they were made. Only hooks without results can be delivered
+// asynchronously, and their arguments must not be modified by the caller
+// afterwards.
+type AsyncConfig struct {
+	Hooks     []string // defaults to NewHead, NewSideBlock, Reorg and StateUpdate
+	QueueSize int      // defaults to 128
+	Policy    string   // block (default), drop-oldest or halt
+}
+
+// hookQueue runs the asynchronous hook invocations of a single plugin.
+type hookQueue struct {
+	name   string
+	hooks  map[string]struct{}
+	policy string
+	tasks  chan func()
+	depth  metrics.Gauge
+	drops  metrics.Counter
+
+	lock   sync.RWMutex // held for writing when closing tasks
+	closed bool
+	halted int32 // accessed atomically
+	done   chan struct{}
+}
+
+func newHookQueue(name string, cfg AsyncConfig) (*hookQueue, error) {
+	switch cfg.Policy {
+	case "":
+		cfg.Policy = PolicyBlock
+	case PolicyBlock, PolicyDropOldest, PolicyHalt:
+	default:
+		return nil, fmt.Errorf("unknown queue policy %q", cfg.Policy)
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = defaultQueueSize
+	}
+	if len(cfg.Hooks) == 0 {
+		cfg.Hooks = defaultAsyncHooks
+	}
+	q := &hookQueue{
+		name:   name,
+		hooks:  make(map[string]struct{}),
+		policy: cfg.Policy,
+		tasks:  make(chan func(), cfg.QueueSize),
+		depth:  metrics.GetOrRegisterGauge(fmt.Sprintf("plugins/%v/queue/depth", name), nil),
+		drops:  metrics.GetOrRegisterCounter(fmt.Sprintf("plugins/%v/queue/dropped", name), nil),
+		done:   make(chan struct{}),
+	}
+	for _, hook := range cfg.Hooks {
+		q.hooks[hook] = struct{}{}
+	}
+	go q.loop()
+	return q, nil
+}
+
+func (q *hookQueue) loop() {
+	defer close(q.done)
+	for task := range q.tasks {
+		q.depth.Update(int64(len(q.tasks)))
+		task()
+	}
+}
+
+// wrap returns a function of the same type as v that queues invocations of v,
+// or v itself if the hook is not delivered asynchronously.
+func (q *hookQueue) wrap(hook string, v interface{}) interface{} {
+	if _, ok := q.hooks[hook]; !ok {
+		return v
+	}
+	fn := reflect.ValueOf(v)
+	if fn.Kind() != reflect.Func || fn.Type().NumOut() > 0 {
+		log.Warn("Plugin hook cannot be delivered asynchronously, invoking it synchronously", "plugin", q.name, "hook", hook)
+		return v
+	}
+	return reflect.MakeFunc(fn.Type(), func(args []reflect.Value) []reflect.Value {
+		q.enqueue(hook, func() {
+			if fn.Type().IsVariadic() {
+				fn.CallSlice(args)
+			} else {
+				fn.Call(args)
+			}
+		})
+		return nil
+	}).Interface()
+}
+
+func (q *hookQueue) enqueue(hook string, task func()) {
+	q.lock.RLock()
+	defer q.lock.RUnlock()
+	if q.closed {
+		log.Warn("Plugin hook invoked after shutdown, discarding", "plugin", q.name, "hook", hook)
+		return
+	}
+	if atomic.LoadInt32(&q.halted) == 1 {
+		q.drops.Inc(1)
+		return
+	}
+	select {
+	case q.tasks <- task:
+	default:
+		switch q.policy {
+		case PolicyBlock:
+			q.tasks <- task
+		case PolicyDropOldest:
+			select {
+			case <-q.tasks:
+				q.drops.Inc(1)
+				log.Debug("Plugin queue is full, dropped oldest hook invocation", "plugin", q.name)
+			default:
+			}
+			select {
+			case q.tasks <- task:
+			default:
+				q.drops.Inc(1)
+			}
+		case PolicyHalt:
+			q.drops.Inc(1)
+			if atomic.CompareAndSwapInt32(&q.halted, 0, 1) {
+				log.Error("Plugin queue is full, halting hook delivery until the plugin is reloaded", "plugin", q.name, "hook", hook, "size", cap(q.tasks))
+			}
+		}
+	}
+	q.depth.Update(int64(len(q.tasks)))
+}
+
+// close stops accepting invocations and waits for the queued ones to run.
+func (q *hookQueue) close() {
+	q.lock.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.tasks)
+	}
+	q.lock.Unlock()
+	<-q.done
+}
@@ -0,0 +1,100 @@
+package plugins
+
+import (
+	"testing"
+)
+
+func TestAsyncDelivery(t *testing.T) {
+	var (
+		started = make(chan struct{}, 1)
+		release = make(chan struct{})
+		heads   []int
+	)
+	queue, err := newHookQueue("async", AsyncConfig{Hooks: []string{"NewHead", "Result"}, QueueSize: 2, Policy: PolicyDropOldest})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pl := &PluginLoader{
+		Plugins: []pluginDetails{{
+			p: testPlugin{
+				"NewHead": func(n int) {
+					select {
+					case started <- struct{}{}:
+					default:
+					}
+					<-release
+					heads = append(heads, n)
+				},
+				"Result": func() int { return 1 },
+			},
+			name:  "async",
+			file:  "async.so",
+			queue: queue,
+		}},
+		LookupCache: make(map[string][]interface{}),
+	}
+	fns := pl.Lookup("NewHead", func(item interface{}) bool {
+		_, ok := item.(func(int))
+		return ok
+	})
+	newHead := fns[0].(func(int))
+	// The first invocation is picked up by the queue's goroutine and blocks,
+	// the rest fill the queue, dropping the oldest queued ones.
+	newHead(0)
+	<-started
+	for i := 1; i <= 4; i++ {
+		newHead(i)
+	}
+	close(release)
+	pl.Drain()
+	if len(heads) != 3 || heads[0] != 0 || heads[1] != 3 || heads[2] != 4 {
+		t.Errorf("Unexpected delivered heads %v", heads)
+	}
+	newHead(5)
+	if len(heads) != 3 {
+		t.Errorf("Expected hook invoked after draining to be discarded")
+	}
+
+	fns = pl.Lookup("Result", func(item interface{}) bool {
+		_, ok := item.(func() int)
+		return ok
+	})
+	if fns[0].(func() int)() != 1 {
+		t.Errorf("Expected hook with results to be invoked synchronously")
+	}
+}
+
+func TestAsyncPolicy(t *testing.T) {
+	if _, err := newHookQueue("async", AsyncConfig{Policy: "unknown"}); err == nil {
+		t.Errorf("Expected unknown policy to be rejected")
+	}
+
+	// A halting queue stops delivery at the first invocation that does not fit
+	queue, err := newHookQueue("halt", AsyncConfig{QueueSize: 1, Policy: PolicyHalt})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var (
+		started = make(chan struct{}, 1)
+		release = make(chan struct{})
+		heads   []int
+	)
+	newHead := queue.wrap("NewHead", func(n int) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		heads = append(heads, n)
+	}).(func(int))
+	newHead(0)
+	<-started
+	newHead(1)
+	newHead(2) // halts
+	close(release)
+	newHead(3)
+	queue.close()
+	if len(heads) != 2 || heads[0] != 0 || heads[1] != 1 {
+		t.Errorf("Unexpected delivered heads %v", heads)
+	}
+}
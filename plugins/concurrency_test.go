@@ -0,0 +1,133 @@
+package plugins
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// These tests are meant to be run with the race detector.
+
+func newConcurrentLoader(calls *int64) *PluginLoader {
+	pl := &PluginLoader{LookupCache: make(map[string][]interface{})}
+	for i := 0; i < 4; i++ {
+		pl.Plugins = append(pl.Plugins, pluginDetails{
+			p: testPlugin{
+				"NewHead":     func(n int) { atomic.AddInt64(calls, 1) },
+				"StateUpdate": func(n int) { atomic.AddInt64(calls, 1) },
+				"GetRPCCalls": func(id, method, params string) { atomic.AddInt64(calls, 1) },
+			},
+			name:     fmt.Sprintf("plugin%d", i),
+			file:     fmt.Sprintf("/plugins/plugin%d.so", i),
+			manifest: &Manifest{Name: fmt.Sprintf("plugin%d", i)},
+			provides: make(map[string]struct{}),
+		})
+	}
+	return pl
+}
+
+func dispatch(pl *PluginLoader, hook string) {
+	switch hook {
+	case "GetRPCCalls":
+		for _, fni := range pl.Lookup(hook, func(item interface{}) bool {
+			_, ok := item.(func(string, string, string))
+			return ok
+		}) {
+			fni.(func(string, string, string))("1", "eth_call", "[]")
+		}
+	default:
+		for _, fni := range pl.Lookup(hook, func(item interface{}) bool {
+			_, ok := item.(func(int))
+			return ok
+		}) {
+			fni.(func(int))(1)
+		}
+	}
+}
+
+func TestConcurrentLookup(t *testing.T) {
+	var (
+		calls int64
+		pl    = newConcurrentLoader(&calls)
+		hooks = []string{"NewHead", "StateUpdate", "GetRPCCalls"}
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				dispatch(pl, hooks[(i+j)%len(hooks)])
+			}
+		}(i)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 20; j++ {
+			pl.PluginInfo()
+			pl.HookStats()
+			pl.Split()
+		}
+	}()
+	wg.Wait()
+	if calls != 16*100*4 {
+		t.Errorf("Expected %d hook invocations, got %d", 16*100*4, calls)
+	}
+}
+
+func TestConcurrentReload(t *testing.T) {
+	var (
+		calls int64
+		pl    = newConcurrentLoader(&calls)
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				dispatch(pl, "NewHead")
+			}
+		}()
+	}
+	for j := 0; j < 10; j++ {
+		replacement := pluginDetails{
+			p:        testPlugin{"NewHead": func(n int) { atomic.AddInt64(&calls, 1) }},
+			name:     "plugin0",
+			file:     fmt.Sprintf("/plugins/plugin0-v%d.so", j),
+			manifest: &Manifest{Name: "plugin0"},
+			provides: make(map[string]struct{}),
+		}
+		pl.replace([]pluginDetails{replacement}, nil)
+	}
+	wg.Wait()
+	if n := len(pl.plugins()); n != 4 {
+		t.Errorf("Expected 4 plugins after reloading, got %d", n)
+	}
+	if calls != 8*100*4 {
+		t.Errorf("Expected %d hook invocations, got %d", 8*100*4, calls)
+	}
+}
+
+func TestConcurrentHookTester(t *testing.T) {
+	var calls int64
+	done := HookTester("NewHead", func(n int) { atomic.AddInt64(&calls, 1) })
+	defer done()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				dispatch(DefaultPluginLoader, "NewHead")
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 16*100 {
+		t.Errorf("Expected %d hook invocations, got %d", 16*100, calls)
+	}
+}
@@ -0,0 +1,167 @@
+package plugins
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// prefix is the name a plugin's settings section and flags are namespaced
+// under: its manifest name, or its file name without extension.
+func (p pluginDetails) prefix() string {
+	if p.manifest != nil && p.manifest.Name != "" {
+		return p.manifest.Name
+	}
+	return fileNames(filepath.Base(p.file))[1]
+}
+
+// checkConflicts reports plugins that share a name, as well as flags defined
+// by more than one plugin. Such flags must be prefixed with the plugin name.
+func (pl *PluginLoader) checkConflicts() {
+	names := make(map[string]string)
+	owners := make(map[string][]string)
+	for _, plugin := range pl.Plugins {
+		if other, ok := names[plugin.prefix()]; ok {
+			log.Error("Multiple plugins share a name, settings and flags will be ambiguous", "name", plugin.prefix(), "file", plugin.file, "other", other)
+		}
+		names[plugin.prefix()] = plugin.file
+		if plugin.flags != nil {
+			plugin.flags.VisitAll(func(f *flag.Flag) {
+				owners[f.Name] = append(owners[f.Name], plugin.prefix())
+			})
+		}
+	}
+	for name, plugins := range owners {
+		if len(plugins) > 1 {
+			log.Warn("Flag is defined by multiple plugins, it must be prefixed with the plugin name", "flag", name, "plugins", plugins)
+		}
+	}
+}
+
+// Configure delivers each plugin its section of settings through the
+// optional Configure hook, which has the signature
+//
+//	func Configure(map[string]interface{}) error
+//
+// Plugins with a Configure hook but no settings receive an empty map. Any
+// error returned by a plugin aborts startup.
+func (pl *PluginLoader) Configure(settings map[string]map[string]interface{}) error {
+	used := make(map[string]struct{})
+	for _, plugin := range pl.Plugins {
+		if _, ok := settings[plugin.prefix()]; ok {
+			used[plugin.prefix()] = struct{}{}
+		}
+		if err := plugin.configure(settings); err != nil {
+			return err
+		}
+	}
+	for name := range settings {
+		if _, ok := used[name]; !ok {
+			log.Warn("Settings provided for a plugin that is not loaded", "plugin", name)
+		}
+	}
+	return nil
+}
+
+// configure invokes the Configure hook of the plugin with its section of
+// settings, if it has one.
+func (p pluginDetails) configure(settings map[string]map[string]interface{}) error {
+	section, ok := settings[p.prefix()]
+	if !ok {
+		section = make(map[string]interface{})
+	}
+	v, err := p.p.Lookup("Configure")
+	if err != nil {
+		if ok {
+			log.Warn("Plugin has settings but no Configure hook", "plugin", p.name)
+		}
+		return nil
+	}
+	fn, isFn := v.(func(map[string]interface{}) error)
+	if !isFn {
+		log.Warn("Plugin matches hook but not signature", "plugin", p.name, "hook", "Configure")
+		return nil
+	}
+	if err := fn(section); err != nil {
+		return fmt.Errorf("plugin %v could not be configured: %v", p.name, err)
+	}
+	return nil
+}
+
+// ParseFlags routes command line flags to the plugins defining them. A flag
+// may be given as --<plugin>.<flag>, or as --<flag> if only one plugin
+// defines it. Flags no plugin defines are reported and skipped, rather than
+// failing the flag parsing of unrelated plugins.
+func (pl *PluginLoader) ParseFlags(args []string) bool {
+	owners := make(map[string][]int)
+	for i, plugin := range pl.Plugins {
+		if plugin.flags != nil {
+			plugin.flags.VisitAll(func(f *flag.Flag) {
+				owners[f.Name] = append(owners[f.Name], i)
+			})
+		}
+	}
+	routed := make(map[int][]string)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, value := strings.TrimLeft(arg, "-"), ""
+		hasValue := false
+		if j := strings.Index(name, "="); j >= 0 {
+			name, value, hasValue = name[:j], name[j+1:], true
+		}
+		target, flagName := -1, name
+		for idx, plugin := range pl.Plugins {
+			if plugin.flags == nil || !strings.HasPrefix(name, plugin.prefix()+".") {
+				continue
+			}
+			if unprefixed := strings.TrimPrefix(name, plugin.prefix()+"."); plugin.flags.Lookup(unprefixed) != nil {
+				target, flagName = idx, unprefixed
+				break
+			}
+		}
+		if target < 0 {
+			switch len(owners[name]) {
+			case 0:
+				log.Warn("Flag is not defined by any plugin", "flag", arg)
+				continue
+			case 1:
+				target = owners[name][0]
+			default:
+				log.Error("Flag is defined by multiple plugins, prefix it with the plugin name", "flag", arg)
+				if !hasValue && !isBoolFlag(pl.Plugins[owners[name][0]].flags.Lookup(name)) {
+					i++
+				}
+				continue
+			}
+		}
+		f := pl.Plugins[target].flags.Lookup(flagName)
+		if !hasValue && !isBoolFlag(f) && i+1 < len(args) {
+			i++
+			value, hasValue = args[i], true
+		}
+		if hasValue {
+			routed[target] = append(routed[target], fmt.Sprintf("--%v=%v", flagName, value))
+		} else {
+			routed[target] = append(routed[target], "--"+flagName)
+		}
+	}
+	for i, plugin := range pl.Plugins {
+		if plugin.flags != nil {
+			if err := plugin.flags.Parse(routed[i]); err != nil {
+				log.Error("Could not parse plugin flags", "plugin", plugin.name, "error", err)
+			}
+		}
+	}
+	return len(pl.Flags) > 0
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
@@ -0,0 +1,62 @@
+package plugins
+
+import (
+	"errors"
+	"flag"
+	"testing"
+)
+
+func newFlagPlugin(name string, configure func(map[string]interface{}) error) (pluginDetails, *string, *bool) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	value := fs.String("value", "", "")
+	verbose := fs.Bool("verbose", false, "")
+	fs.String(name+"-only", "", "")
+	p := testPlugin{"Flags": fs}
+	if configure != nil {
+		p["Configure"] = configure
+	}
+	return pluginDetails{p: p, name: name, file: name + ".so", flags: fs, provides: make(map[string]struct{})}, value, verbose
+}
+
+func TestParseFlags(t *testing.T) {
+	a, aValue, aVerbose := newFlagPlugin("a", nil)
+	b, bValue, bVerbose := newFlagPlugin("b", nil)
+	pl := &PluginLoader{
+		Plugins: []pluginDetails{a, b},
+		Flags:   []*flag.FlagSet{a.flags, b.flags},
+	}
+	pl.ParseFlags([]string{"--a.value", "x", "--b.value=y", "--b.verbose", "--verbose", "--unknown", "--a-only=z", "--value", "ambiguous"})
+	if *aValue != "x" || *bValue != "y" {
+		t.Errorf("Unexpected values a=%q b=%q", *aValue, *bValue)
+	}
+	if *aVerbose || !*bVerbose {
+		t.Errorf("Unexpected verbose a=%v b=%v", *aVerbose, *bVerbose)
+	}
+	if v := a.flags.Lookup("a-only").Value.String(); v != "z" {
+		t.Errorf("Expected unprefixed unique flag to be routed, got %q", v)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	var got map[string]interface{}
+	a, _, _ := newFlagPlugin("a", func(settings map[string]interface{}) error {
+		got = settings
+		return nil
+	})
+	b, _, _ := newFlagPlugin("b", func(settings map[string]interface{}) error {
+		if settings["fail"] == true {
+			return errors.New("bad settings")
+		}
+		return nil
+	})
+	pl := &PluginLoader{Plugins: []pluginDetails{a, b}}
+	if err := pl.Configure(map[string]map[string]interface{}{"a": {"key": "value"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got["key"] != "value" {
+		t.Errorf("Unexpected settings %v", got)
+	}
+	if err := pl.Configure(map[string]map[string]interface{}{"b": {"fail": true}}); err == nil {
+		t.Errorf("Expected Configure error to be returned")
+	}
+}
@@ -0,0 +1,131 @@
+package plugins
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// pluginHealth counts the faults of a plugin's hooks. Once a plugin is
+// quarantined, none of its hooks are invoked for the lifetime of the loader.
+type pluginHealth struct {
+	faults      uint64 // accessed atomically
+	quarantined int32  // accessed atomically
+}
+
+func (h *pluginHealth) isQuarantined() bool {
+	return atomic.LoadInt32(&h.quarantined) == 1
+}
+
+// hookFault is raised, as a panic, by the stub of a hook that cannot complete
+// an invocation for a reason other than a panic in the plugin, such as a
+// plugin process failing to answer in time.
+type hookFault struct {
+	err error
+}
+
+// guard wraps a hook function exported by a plugin so that its invocations are
+// timed, and a panic in the plugin, or a hookFault, is recovered and counted
+// rather than crashing the goroutine invoking it. A hook that faults returns
+// the zero values of its results, as does every hook of a quarantined plugin.
+// Hooks of fallible lookups (see LookupFallible) report the fault in their
+// last result instead, if it is of type error. Tracers returned by hooks, and
+// the tracer constructors of the Tracers hook, are guarded alike (see
+// guardedTracer). Other values that are not functions are returned as-is.
+func (pl *PluginLoader) guard(plugin pluginDetails, hook string, v interface{}, fallible bool) interface{} {
+	if tracers, ok := pl.guardTracers(plugin, hook, v); ok {
+		return tracers
+	}
+	fn := reflect.ValueOf(v)
+	if fn.Kind() != reflect.Func || fn.IsNil() {
+		return v
+	}
+	var (
+		fnType = fn.Type()
+		health = plugin.health
+		name   = plugin.prefix()
+		timer  = metrics.GetOrRegisterTimer(fmt.Sprintf("plugins/%v/%v/duration", name, hook), nil)
+		stats  = pl.hookStats(name, hook)
+	)
+	faulted := func(err error) []reflect.Value {
+		if fallible {
+			return faultResults(fnType, err)
+		}
+		return zeroResults(fnType)
+	}
+	return reflect.MakeFunc(fnType, func(args []reflect.Value) (results []reflect.Value) {
+		if health.isQuarantined() {
+			return faulted(fmt.Errorf("plugin %v is quarantined", name))
+		}
+		start := time.Now()
+		defer func() {
+			elapsed := time.Since(start)
+			timer.Update(elapsed)
+			stats.record(elapsed)
+			if pl.SlowHookThreshold > 0 && elapsed > pl.SlowHookThreshold {
+				log.Warn("Slow plugin hook", "plugin", name, "hook", hook, "elapsed", common.PrettyDuration(elapsed))
+			}
+			if r := recover(); r != nil {
+				results = faulted(pl.fault(plugin, hook, r))
+			}
+		}()
+		if fnType.IsVariadic() {
+			results = fn.CallSlice(args)
+		} else {
+			results = fn.Call(args)
+		}
+		for i, result := range results {
+			results[i] = pl.guardResult(plugin, hook, result)
+		}
+		return results
+	}).Interface()
+}
+
+// fault accounts for a fault of a hook of plugin, recovered as r, quarantining
+// the plugin once it faulted too often. It returns the fault as an error.
+func (pl *PluginLoader) fault(plugin pluginDetails, hook string, r interface{}) error {
+	var (
+		err    error
+		name   = plugin.prefix()
+		faults = atomic.AddUint64(&plugin.health.faults, 1)
+	)
+	if f, ok := r.(hookFault); ok {
+		metrics.GetOrRegisterCounter(fmt.Sprintf("plugins/%v/%v/failures", name, hook), nil).Inc(1)
+		err = fmt.Errorf("plugin %v hook %v failed: %v", name, hook, f.err)
+		log.Error("Plugin hook failed", "plugin", name, "hook", hook, "faults", faults, "error", f.err)
+	} else {
+		metrics.GetOrRegisterCounter(fmt.Sprintf("plugins/%v/%v/panics", name, hook), nil).Inc(1)
+		err = fmt.Errorf("plugin %v hook %v panicked: %v", name, hook, r)
+		log.Error("Plugin hook panicked", "plugin", name, "hook", hook, "faults", faults, "error", r, "stack", string(debug.Stack()))
+	}
+	if pl.MaxFaults > 0 && faults >= pl.MaxFaults && atomic.CompareAndSwapInt32(&plugin.health.quarantined, 0, 1) {
+		log.Error("Plugin quarantined, its hooks will no longer be invoked", "plugin", name, "faults", faults)
+	}
+	return err
+}
+
+func zeroResults(t reflect.Type) []reflect.Value {
+	results := make([]reflect.Value, t.NumOut())
+	for i := range results {
+		results[i] = reflect.Zero(t.Out(i))
+	}
+	return results
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// faultResults returns the results of a fallible hook of type t that faulted
+// with err.
+func faultResults(t reflect.Type, err error) []reflect.Value {
+	results := zeroResults(t)
+	if n := len(results); n > 0 && t.Out(n-1) == errorType {
+		results[n-1] = reflect.ValueOf(&err).Elem()
+	}
+	return results
+}
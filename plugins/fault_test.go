@@ -0,0 +1,119 @@
+package plugins
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+func TestPanicIsolation(t *testing.T) {
+	var calls int
+	pl := &PluginLoader{
+		Plugins: []pluginDetails{
+			{p: testPlugin{"Hook": func(n int) (int, error) { panic("faulty plugin") }, "FallibleHook": func(n int) (int, error) { return n, nil }}, name: "faulty", file: "faulty.so"},
+			{p: testPlugin{"Hook": func(n int) (int, error) { calls++; return n, errors.New("ok") }}, name: "healthy", file: "healthy.so"},
+		},
+		LookupCache: make(map[string][]interface{}),
+		MaxFaults:   2,
+	}
+	fns := pl.Lookup("Hook", func(item interface{}) bool {
+		_, ok := item.(func(int) (int, error))
+		return ok
+	})
+	if len(fns) != 2 {
+		t.Fatalf("Expected two hooks, got %d", len(fns))
+	}
+	fallible := pl.LookupFallible("FallibleHook", func(interface{}) bool { return true })
+	for i := 0; i < 3; i++ {
+		for _, fni := range fns {
+			fn := fni.(func(int) (int, error))
+			fn(1)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("Expected healthy plugin to be called 3 times, got %d", calls)
+	}
+	if n, err := fns[0].(func(int) (int, error))(1); n != 0 || err != nil {
+		t.Errorf("Expected zero results from faulty hook, got %v %v", n, err)
+	}
+	if n, err := fallible[0].(func(int) (int, error))(1); n != 0 || err == nil {
+		t.Errorf("Expected zero value and an error from fallible quarantined hook, got %v %v", n, err)
+	}
+	info := pl.PluginInfo()
+	if info[0].Faults != 2 || !info[0].Quarantined {
+		t.Errorf("Expected faulty plugin to be quarantined after 2 faults, got %d faults", info[0].Faults)
+	}
+	if info[1].Faults != 0 || info[1].Quarantined {
+		t.Errorf("Expected healthy plugin not to be quarantined")
+	}
+	if metrics.Enabled {
+		if c := metrics.GetOrRegisterCounter("plugins/faulty/Hook/panics", nil).Count(); c != 2 {
+			t.Errorf("Expected 2 panics to be counted, got %d", c)
+		}
+	}
+	pl.LookupCache = make(map[string][]interface{})
+	if fns := pl.Lookup("Hook", func(interface{}) bool { return true }); len(fns) != 1 {
+		t.Errorf("Expected quarantined plugin to be skipped by Lookup, got %d hooks", len(fns))
+	}
+}
+
+func TestHookStats(t *testing.T) {
+	pl := &PluginLoader{
+		Plugins:     []pluginDetails{{p: testPlugin{"Hook": func() { time.Sleep(time.Millisecond) }}, name: "slow", file: "slow.so"}},
+		LookupCache: make(map[string][]interface{}),
+
+		SlowHookThreshold: time.Nanosecond,
+	}
+	fns := pl.Lookup("Hook", func(item interface{}) bool {
+		_, ok := item.(func())
+		return ok
+	})
+	for i := 0; i < 2; i++ {
+		fns[0].(func())()
+	}
+	stats := pl.HookStats()
+	if len(stats) != 1 {
+		t.Fatalf("Expected stats for one hook, got %d", len(stats))
+	}
+	if s := stats[0]; s.Plugin != "slow" || s.Hook != "Hook" || s.Calls != 2 || s.Max < time.Millisecond || s.Mean < time.Millisecond || s.Total < 2*time.Millisecond {
+		t.Errorf("Unexpected stats %+v", s)
+	}
+}
+
+type panickingTracer struct{ core.BlockTracer }
+
+func (t panickingTracer) PreProcessBlock(core.Hash, uint64, []byte) { panic("faulty tracer") }
+func (t panickingTracer) Result() (interface{}, error)              { panic("faulty tracer") }
+
+func TestTracerIsolation(t *testing.T) {
+	tracers := map[string]func(core.StateDB) core.TracerResult{
+		"faulty": func(core.StateDB) core.TracerResult { return panickingTracer{} },
+	}
+	pl := &PluginLoader{
+		Plugins: []pluginDetails{{p: testPlugin{
+			"GetLiveTracer": func(core.Hash, core.StateDB) core.BlockTracer { return panickingTracer{} },
+			"Tracers":       &tracers,
+		}, name: "faulty", file: "faulty.so"}},
+		LookupCache: make(map[string][]interface{}),
+		MaxFaults:   3,
+	}
+	live := pl.Lookup("GetLiveTracer", func(interface{}) bool { return true })[0].(func(core.Hash, core.StateDB) core.BlockTracer)(core.Hash{}, nil)
+	live.PreProcessBlock(core.Hash{}, 1, nil)
+	if _, err := live.Result(); err == nil {
+		t.Errorf("Expected the fault of the tracer to be reported by Result")
+	}
+	ctors := pl.Lookup("Tracers", func(interface{}) bool { return true })[0].(*map[string]func(core.StateDB) core.TracerResult)
+	if _, err := (*ctors)["faulty"](nil).Result(); err == nil {
+		t.Errorf("Expected the fault of the tracer to be reported by Result")
+	}
+	if info := pl.PluginInfo(); info[0].Faults != 3 || !info[0].Quarantined {
+		t.Errorf("Expected the faults of tracers to quarantine the plugin, got %d faults", info[0].Faults)
+	}
+	live.PreProcessBlock(core.Hash{}, 2, nil) // Not invoked once quarantined
+	if faults := pl.PluginInfo()[0].Faults; faults != 3 {
+		t.Errorf("Expected the tracer of a quarantined plugin not to be invoked, got %d faults", faults)
+	}
+}
@@ -0,0 +1,25 @@
+// Package freezer defines the values delivered to FreezerBatch plugins. It only
+// depends on plugeth-utils, so plugins, in process or not, can use it without
+// importing the rawdb package of geth.
+package freezer
+
+import (
+	"math/big"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+// Block is a block written to the freezer. As in the other hooks delivering
+// blocks, such as NewHead, the header, body and receipts cross the plugin
+// boundary RLP encoded, for plugins to decode into the types of plugeth-utils
+// (restricted/types Header, Body and []*ReceiptForStorage, the receipts being
+// stored without their derived fields). Items missing from the freezer are
+// left nil, or zero for the hash.
+type Block struct {
+	Number   uint64    `json:"number"`
+	Hash     core.Hash `json:"hash"`
+	Header   []byte    `json:"header"`
+	Body     []byte    `json:"body"`
+	Receipts []byte    `json:"receipts"`
+	Td       *big.Int  `json:"td"`
+}
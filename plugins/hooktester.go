@@ -1,5 +1,9 @@
 package plugins
 
+import (
+	"fmt"
+	"plugin"
+)
 
 // type PluginLoader struct{
 // 	Plugins []*plugin.Plugin
@@ -17,3 +21,24 @@ func HookTester(name string, fn interface{}) func() {
   }
   return func() { DefaultPluginLoader = oldDefault }
 }
+
+// symbols serves the values of a plugin built in memory, by name.
+type symbols map[string]interface{}
+
+func (s symbols) Lookup(name string) (plugin.Symbol, error) {
+	if v, ok := s[name]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("symbol %v not found", name)
+}
+
+// GuardedHookTester is like HookTester, but fn is looked up from a plugin, so
+// that it is isolated like the hooks of loaded plugins (see guard).
+func GuardedHookTester(name string, fn interface{}) func() {
+	oldDefault := DefaultPluginLoader
+	DefaultPluginLoader = &PluginLoader{
+		Plugins:     []pluginDetails{{p: symbols{name: fn}, name: "test", file: "test.so"}},
+		LookupCache: make(map[string][]interface{}),
+	}
+	return func() { DefaultPluginLoader = oldDefault }
+}
@@ -0,0 +1,220 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// defaultAPIVersion is reported when build information is unavailable. It
+// should track the plugeth-utils requirement in go.mod.
+const defaultAPIVersion = "v0.0.18"
+
+// APIVersion is the version of plugeth-utils this build of geth provides to
+// plugins.
+var APIVersion = apiVersion()
+
+func apiVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/openrelayxyz/plugeth-utils" {
+				return dep.Version
+			}
+		}
+	}
+	return defaultAPIVersion
+}
+
+// Manifest describes a plugin. Shared object plugins export it as a variable
+// named PluginManifest, which may be of any type that encodes to the JSON
+// below (a struct with matching fields or a map[string]interface{}), so that
+// plugins do not need to import geth. Plugins running in their own process
+// provide the same fields in their `.plugin.json` file.
+type Manifest struct {
+	Name       string   `json:"name"`
+	Version    string   `json:"version"`
+	APIVersion string   `json:"apiVersion"` // plugeth-utils version the plugin was built against
+	Hooks      []string `json:"hooks"`
+	Priority   int      `json:"priority"` // see sortPlugins
+}
+
+func decodeManifest(v interface{}) (*Manifest, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("could not decode %v as a plugin manifest: %v", reflect.TypeOf(v), err)
+	}
+	return m, nil
+}
+
+// checkManifest validates a plugin against its manifest. An error means the
+// plugin must not be loaded; hooks the manifest declares but the plugin does
+// not export are only logged.
+func checkManifest(p symbolSource, m *Manifest, fpath string) error {
+	if m.APIVersion != "" {
+		if err := checkAPIVersion(m.APIVersion, APIVersion); err != nil {
+			return err
+		}
+	} else {
+		log.Warn("Plugin manifest does not declare a plugeth-utils API version", "file", fpath)
+	}
+	for _, hook := range m.Hooks {
+		if _, err := p.Lookup(hook); err != nil {
+			log.Error("Plugin manifest declares a hook the plugin does not provide", "plugin", m.Name, "hook", hook, "file", fpath)
+		}
+	}
+	return nil
+}
+
+// checkAPIVersion reports whether a plugin requiring the API version
+// `required` can run against `provided`. Versions are compared as semantic
+// versions: the major version (or the minor version, for v0 releases) must
+// match, and the plugin must not require a newer release than geth provides.
+func checkAPIVersion(required, provided string) error {
+	req, err := parseVersion(required)
+	if err != nil {
+		return fmt.Errorf("invalid plugin API version %q: %v", required, err)
+	}
+	have, err := parseVersion(provided)
+	if err != nil {
+		// Geth was built from an unversioned checkout of plugeth-utils, so
+		// there is nothing meaningful to compare against.
+		return nil
+	}
+	if req[0] != have[0] || (req[0] == 0 && req[1] != have[1]) {
+		return fmt.Errorf("plugin requires plugeth-utils %v, which is incompatible with %v", required, provided)
+	}
+	for i := range req {
+		if req[i] != have[i] {
+			if req[i] > have[i] {
+				return fmt.Errorf("plugin requires plugeth-utils %v, but geth provides %v", required, provided)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+func parseVersion(v string) ([3]int, error) {
+	var result [3]int
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) > 3 {
+		return result, fmt.Errorf("too many components")
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return result, err
+		}
+		result[i] = n
+	}
+	return result, nil
+}
+
+// PluginInfo describes a loaded plugin.
+type PluginInfo struct {
+	Name        string   `json:"name"`
+	File        string   `json:"file"`
+	Version     string   `json:"version,omitempty"`
+	APIVersion  string   `json:"apiVersion,omitempty"`
+	Remote      bool     `json:"remote"`
+	Priority    int      `json:"priority"`
+	Declared    []string `json:"declaredHooks"`
+	Hooks       []string `json:"hooks"` // hooks the plugin exports, less those not matching their signature
+	Faults      uint64   `json:"faults"`
+	Quarantined bool     `json:"quarantined"`
+}
+
+// knownHooks are the hooks geth looks up. Plugins are probed for them as they
+// are loaded, so that their hooks are known before being dispatched.
+var knownHooks = []string{
+	"AppendAncient", "BlockProcessingError", "Configure", "CreateEngine",
+	"FreezerBatch", "FreezerTruncateHead", "FreezerTruncateTail", "GetAPIs",
+	"GetLiveTracer", "GetRPCCalls", "GetSnapshotAccount", "GetSnapshotStorage",
+	"Initialize", "InitializeNode", "ModifyAncients", "NewBlock",
+	"NewBlockHashes", "NewHead", "NewPooledTransactionHashes", "NewSideBlock",
+	"OnShutdown", "OrderTransactions", "PayloadBuilt", "PayloadFeeRecipient",
+	"PayloadTransactions", "PeerConnected", "PeerDisconnected", "PeerFilter",
+	"PoolTransactionAdded", "PoolTransactionDropped", "PoolTransactionReplaced",
+	"PostProcessBlock", "PostProcessTransaction", "PreProcessBlock",
+	"PreProcessTransaction", "Precompiles", "RPCBatchComplete",
+	"RPCCallComplete", "RPCCallRequest", "RPCCallResponse", "Reorg",
+	"SnapSyncPhase", "StateDiff", "StateUpdate", "SyncCompleted", "SyncPivot",
+	"SyncStarted", "Tracers", "TrustedPeers", "ValidatePoolTransaction",
+}
+
+// exportedHooks returns the known hooks p exports. Plugins running in their
+// own process export the hooks they listed when connecting.
+func exportedHooks(p symbolSource) map[string]struct{} {
+	hooks := make(map[string]struct{})
+	for _, hook := range knownHooks {
+		if _, err := p.Lookup(hook); err == nil {
+			hooks[hook] = struct{}{}
+		}
+	}
+	return hooks
+}
+
+// PluginInfo lists the loaded plugins in dispatch order.
+func (pl *PluginLoader) PluginInfo() []PluginInfo {
+	plugins := pl.plugins()
+	result := make([]PluginInfo, 0, len(plugins))
+	for _, plugin := range plugins {
+		info := PluginInfo{
+			Name:     plugin.name,
+			File:     plugin.file,
+			Priority: plugin.priority,
+			Declared: []string{},
+			Hooks:    []string{},
+		}
+		if _, ok := plugin.p.(*remotePlugin); ok {
+			info.Remote = true
+		}
+		if plugin.manifest != nil {
+			info.Version = plugin.manifest.Version
+			info.APIVersion = plugin.manifest.APIVersion
+			info.Declared = append(info.Declared, plugin.manifest.Hooks...)
+		}
+		providesLock.Lock()
+		for hook := range plugin.provides {
+			info.Hooks = append(info.Hooks, hook)
+		}
+		providesLock.Unlock()
+		sort.Strings(info.Hooks)
+		if plugin.health != nil {
+			info.Faults = atomic.LoadUint64(&plugin.health.faults)
+			info.Quarantined = plugin.health.isQuarantined()
+		}
+		result = append(result, info)
+	}
+	return result
+}
+
+// API exposes information about the plugin loader over RPC, under the
+// plugeth namespace.
+type API struct {
+	pl *PluginLoader
+}
+
+func NewAPI(pl *PluginLoader) *API {
+	return &API{pl}
+}
+
+// ListPlugins returns the loaded plugins along with the hooks they provide.
+func (api *API) ListPlugins() []PluginInfo {
+	return api.pl.PluginInfo()
+}
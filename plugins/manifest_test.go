@@ -0,0 +1,103 @@
+package plugins
+
+import (
+	"fmt"
+	"plugin"
+	"reflect"
+	"testing"
+)
+
+// testPlugin is a symbolSource backed by a map, standing in for a plugin
+// opened with plugin.Open.
+type testPlugin map[string]interface{}
+
+func (p testPlugin) Lookup(name string) (plugin.Symbol, error) {
+	if v, ok := p[name]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("symbol %v not found", name)
+}
+
+func TestCheckAPIVersion(t *testing.T) {
+	tests := []struct {
+		required, provided string
+		ok                 bool
+	}{
+		{"v0.0.18", "v0.0.18", true},
+		{"v0.0.17", "v0.0.18", true},
+		{"0.0.18", "v0.0.18", true},
+		{"v0.0.19", "v0.0.18", false},
+		{"v0.1.0", "v0.0.18", false},
+		{"v1.0.0", "v0.0.18", false},
+		{"v1.2.0", "v1.3.1", true},
+		{"v1.4.0", "v1.3.1", false},
+		{"v2.0.0", "v1.3.1", false},
+		{"v0.0.18", "(devel)", true},
+		{"latest", "v0.0.18", false},
+	}
+	for _, tt := range tests {
+		err := checkAPIVersion(tt.required, tt.provided)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkAPIVersion(%q, %q) = %v, expected ok=%v", tt.required, tt.provided, err, tt.ok)
+		}
+	}
+}
+
+func TestDecodeManifest(t *testing.T) {
+	type manifest struct {
+		Name       string   `json:"name"`
+		Version    string   `json:"version"`
+		APIVersion string   `json:"apiVersion"`
+		Hooks      []string `json:"hooks"`
+	}
+	expected := &Manifest{Name: "test", Version: "1.0.0", APIVersion: "v0.0.18", Hooks: []string{"NewHead"}}
+	for _, v := range []interface{}{
+		&manifest{"test", "1.0.0", "v0.0.18", []string{"NewHead"}},
+		&map[string]interface{}{"name": "test", "version": "1.0.0", "apiVersion": "v0.0.18", "hooks": []string{"NewHead"}},
+	} {
+		m, err := decodeManifest(v)
+		if err != nil {
+			t.Fatalf("Could not decode %T: %v", v, err)
+		}
+		if !reflect.DeepEqual(m, expected) {
+			t.Errorf("Unexpected manifest %v from %T", m, v)
+		}
+	}
+}
+
+func TestPluginInfo(t *testing.T) {
+	p := testPlugin{
+		"NewHead":     func() {},
+		"StateUpdate": func(int) {},
+	}
+	m := &Manifest{Name: "test", Version: "1.0.0", APIVersion: APIVersion, Hooks: []string{"NewHead", "StateUpdate"}}
+	if err := checkManifest(p, m, "test.so"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := checkManifest(p, &Manifest{APIVersion: "v99.0.0"}, "test.so"); err == nil {
+		t.Errorf("Expected incompatible API version to be rejected")
+	}
+	pl := &PluginLoader{
+		Plugins:     []pluginDetails{{p: p, name: "test", file: "test.so", manifest: m, provides: exportedHooks(p)}},
+		LookupCache: make(map[string][]interface{}),
+	}
+	if hooks := pl.PluginInfo()[0].Hooks; !reflect.DeepEqual(hooks, []string{"NewHead", "StateUpdate"}) {
+		t.Errorf("Expected exported hooks before dispatch, got %v", hooks)
+	}
+	for _, hook := range []string{"NewHead", "StateUpdate"} {
+		pl.Lookup(hook, func(item interface{}) bool {
+			_, ok := item.(func())
+			return ok
+		})
+	}
+	info := pl.PluginInfo()
+	if len(info) != 1 {
+		t.Fatalf("Expected one plugin, got %d", len(info))
+	}
+	if !reflect.DeepEqual(info[0].Hooks, []string{"NewHead"}) {
+		t.Errorf("Expected hooks not matching their signature to be dropped, got %v", info[0].Hooks)
+	}
+	if !reflect.DeepEqual(info[0].Declared, m.Hooks) {
+		t.Errorf("Expected declared hooks %v, got %v", m.Hooks, info[0].Declared)
+	}
+}
@@ -0,0 +1,103 @@
+package plugins
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// orderFile is read from the plugins directory when no explicit order is
+// configured. It lists plugin names, one per line; blank lines and lines
+// starting with # are ignored.
+const orderFile = "plugins.order"
+
+// Plugins are dispatched in a deterministic order, which Lookup preserves in
+// the list of hooks it returns:
+//
+//  1. Plugins named in the configured order (Config.Order, or the
+//     plugins.order file), in the order listed. Plugins may be named by their
+//     manifest name or by their file name, with or without its extension, as
+//     in Config.Enable and Config.Disable.
+//  2. All other plugins, by descending priority. A plugin declares its
+//     priority in its manifest, or by exporting `PluginPriority` as an int.
+//     Plugins that declare nothing have priority 0.
+//  3. Plugins of equal priority, by file name.
+//
+// Hooks that combine the results of every plugin (such as GetAPIs or
+// GetLiveTracer) invoke them in this order. For hooks where a single result
+// is used, the first plugin in this order wins: a tracer name requested
+// through the Tracers hook resolves to the first plugin exporting a tracer by
+// that name.
+func sortPlugins(plugins []pluginDetails, order []string) {
+	rank := make(map[string]int)
+	for i, name := range order {
+		if _, ok := rank[name]; !ok {
+			rank[name] = i
+		}
+	}
+	position := func(p pluginDetails) (int, bool) {
+		i, found := 0, false
+		for _, name := range p.names() {
+			if r, ok := rank[name]; ok && (!found || r < i) {
+				i, found = r, true
+			}
+		}
+		return i, found
+	}
+	for name := range rank {
+		found := false
+		for _, p := range plugins {
+			for _, n := range p.names() {
+				found = found || n == name
+			}
+		}
+		if !found {
+			log.Warn("Plugin order names a plugin that is not loaded", "plugin", name)
+		}
+	}
+	sort.SliceStable(plugins, func(i, j int) bool {
+		ri, iok := position(plugins[i])
+		rj, jok := position(plugins[j])
+		switch {
+		case iok && jok:
+			return ri < rj
+		case iok != jok:
+			return iok
+		case plugins[i].priority != plugins[j].priority:
+			return plugins[i].priority > plugins[j].priority
+		}
+		return filepath.Base(plugins[i].file) < filepath.Base(plugins[j].file)
+	})
+}
+
+// names returns the names a plugin can be referred to by in the plugin order.
+func (p pluginDetails) names() []string {
+	return append(fileNames(filepath.Base(p.file)), p.name)
+}
+
+// readOrderFile reads the plugin order from the plugins directory, returning
+// nil if there is no order file.
+func readOrderFile(dir string) []string {
+	f, err := os.Open(filepath.Join(dir, orderFile))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	order := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		order = append(order, line)
+	}
+	if err := scanner.Err(); err != nil {
+		log.Warn("Could not read plugin order file", "dir", dir, "error", err)
+	}
+	return order
+}
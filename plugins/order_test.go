@@ -0,0 +1,83 @@
+package plugins
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func pluginNames(plugins []pluginDetails) []string {
+	names := make([]string, len(plugins))
+	for i, p := range plugins {
+		names[i] = p.name
+	}
+	return names
+}
+
+func TestSortPlugins(t *testing.T) {
+	newPlugins := func() []pluginDetails {
+		return []pluginDetails{
+			{name: "a", file: "/plugins/a.so"},
+			{name: "b", file: "/plugins/b.so", priority: 10},
+			{name: "c", file: "/plugins/c.plugin.json", priority: -1},
+			{name: "d", file: "/plugins/d.so", priority: 10},
+			{name: "e", file: "/plugins/extra.so", priority: -2},
+		}
+	}
+	tests := []struct {
+		order    []string
+		expected []string
+	}{
+		{nil, []string{"b", "d", "a", "c", "e"}},
+		{[]string{"c"}, []string{"c", "b", "d", "a", "e"}},
+		{[]string{"a.so", "c", "missing"}, []string{"a", "c", "b", "d", "e"}},
+		{[]string{"d", "c", "b", "a"}, []string{"d", "c", "b", "a", "e"}},
+		{[]string{"extra", "d"}, []string{"e", "d", "b", "a", "c"}},
+		{[]string{"d", "extra.so", "c.plugin.json"}, []string{"d", "e", "c", "b", "a"}},
+		{[]string{"b", "e"}, []string{"b", "e", "d", "a", "c"}},
+	}
+	for _, tt := range tests {
+		plugins := newPlugins()
+		sortPlugins(plugins, tt.order)
+		if names := pluginNames(plugins); !reflect.DeepEqual(names, tt.expected) {
+			t.Errorf("order %v: expected %v, got %v", tt.order, tt.expected, names)
+		}
+	}
+}
+
+func TestReadOrderFile(t *testing.T) {
+	dir := t.TempDir()
+	if order := readOrderFile(dir); order != nil {
+		t.Errorf("Expected no order without order file, got %v", order)
+	}
+	data := "# dispatch order\nfirst\n\n  second.so  \n"
+	if err := ioutil.WriteFile(filepath.Join(dir, orderFile), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if order := readOrderFile(dir); !reflect.DeepEqual(order, []string{"first", "second.so"}) {
+		t.Errorf("Unexpected order %v", order)
+	}
+}
+
+func TestConfigEnabled(t *testing.T) {
+	tests := []struct {
+		cfg      Config
+		names    []string
+		expected bool
+	}{
+		{Config{}, fileNames("a.so"), true},
+		{Config{Disable: []string{"a"}}, fileNames("a.so"), false},
+		{Config{Disable: []string{"a.so"}}, fileNames("a.so"), false},
+		{Config{Disable: []string{"b"}}, fileNames("a.so"), true},
+		{Config{Enable: []string{"b"}}, fileNames("a.so"), false},
+		{Config{Enable: []string{"a"}}, fileNames("a.plugin.json"), true},
+		{Config{Enable: []string{"a"}, Disable: []string{"a"}}, fileNames("a.so"), false},
+		{Config{Enable: []string{"indexer"}}, []string{"indexer"}, true},
+	}
+	for i, tt := range tests {
+		if enabled := tt.cfg.enabled(tt.names...); enabled != tt.expected {
+			t.Errorf("test %d: expected enabled=%v for %v, got %v", i, tt.expected, tt.names, enabled)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted"
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
+)
+
+// blockNumber is a block number given to the API, as a hex number or one of
+// the latest, pending and earliest tags.
+type blockNumber int64
+
+func (n *blockNumber) UnmarshalJSON(data []byte) error {
+	var input string
+	if err := json.Unmarshal(data, &input); err != nil {
+		return err
+	}
+	switch input {
+	case "latest":
+		*n = -1
+	case "pending":
+		*n = -2
+	case "earliest":
+		*n = 0
+	default:
+		number, err := hexutil.DecodeUint64(input)
+		if err != nil {
+			return err
+		}
+		*n = blockNumber(number)
+	}
+	return nil
+}
+
+// BlockUpdates is a service that lets clients query for block updates for a
+// given block by hash or number, or subscribe to new block upates.
+type BlockUpdates struct {
+	updater *blockUpdater
+}
+
+// BlockUpdatesByNumber retrieves a block by number, gets receipts and state
+// updates, and serializes the response. It fails for blocks whose state
+// updates were not stored and whose state is no longer available on disk.
+func (b *BlockUpdates) BlockUpdatesByNumber(ctx context.Context, number blockNumber) (map[string]interface{}, error) {
+	block, err := b.updater.blockByNumber(ctx, int64(number))
+	if err != nil {
+		return nil, err
+	}
+	result, _, _, err := b.updater.blockUpdates(ctx, block)
+	return result, err
+}
+
+// BlockUpdatesByHash retrieves a block by hash, gets receipts and state
+// updates, and serializes the response. It fails for blocks whose state
+// updates were not stored and whose state is no longer available on disk.
+func (b *BlockUpdates) BlockUpdatesByHash(ctx context.Context, hash core.Hash) (map[string]interface{}, error) {
+	block, err := b.updater.blockByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	result, _, _, err := b.updater.blockUpdates(ctx, block)
+	return result, err
+}
+
+// BlockUpdates allows clients to subscribe to notifications of new blocks
+// along with receipts and state updates.
+func (b *BlockUpdates) BlockUpdates(ctx context.Context) (<-chan map[string]interface{}, error) {
+	ch := make(chan map[string]interface{}, 1000)
+	sub := b.updater.feed.Subscribe(ch)
+	go func() {
+		<-ctx.Done()
+		sub.Unsubscribe()
+	}()
+	return ch, nil
+}
+
+// GetAPIs exposes the BlockUpdates service under the plugeth namespace.
+func GetAPIs(stack core.Node, backend restricted.Backend) []core.API {
+	if updates == nil {
+		InitializeNode(stack, backend)
+	}
+	return []core.API{
+		{
+			Namespace: "plugeth",
+			Version:   "1.0",
+			Service:   &BlockUpdates{updates},
+			Public:    true,
+		},
+	}
+}
@@ -1,306 +1,256 @@
 package main
 
 import (
-	"bytes"
-	"fmt"
 	"context"
 	"encoding/json"
-	lru "github.com/hashicorp/golang-lru"
-	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/event"
-	"github.com/ethereum/go-ethereum/plugins"
-	"github.com/ethereum/go-ethereum/node"
-	"github.com/ethereum/go-ethereum/plugins/interfaces"
-	"github.com/ethereum/go-ethereum/cmd/utils"
-	"github.com/ethereum/go-ethereum/log"
-	"github.com/ethereum/go-ethereum/rlp"
-	"github.com/ethereum/go-ethereum/rpc"
-	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted"
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
+	"github.com/openrelayxyz/plugeth-utils/restricted/rlp"
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
 	"github.com/urfave/cli/v2"
-	"io"
 )
 
+// maxBackfill is the maximum number of blocks emitted for a single new head,
+// when heads were skipped or the chain reorganized.
+const maxBackfill = 128
 
 var (
-	pl *plugins.PluginLoader
-	backend interfaces.Backend
-	lastBlock common.Hash
-	cache *lru.Cache
-	blockEvents event.Feed
+	pl      core.PluginLoader
+	log     core.Logger
+	events  core.Feed
+	updates *blockUpdater
 )
 
-
-// stateUpdate will be used to track state updates
-type stateUpdate struct {
-	Destructs map[common.Hash]struct{}
-	Accounts map[common.Hash][]byte
-	Storage map[common.Hash]map[common.Hash][]byte
+// chain is the part of the backend the plugin reads blocks from.
+type chain interface {
+	BlockByNumber(ctx context.Context, number int64) ([]byte, error)
+	BlockByHash(ctx context.Context, hash core.Hash) ([]byte, error)
+	HeaderByHash(ctx context.Context, hash core.Hash) ([]byte, error)
+	GetReceipts(ctx context.Context, hash core.Hash) ([]byte, error)
 }
 
-
-// kvpair is used for RLP encoding of maps, as maps cannot be RLP encoded directly
-type kvpair struct {
-	Key common.Hash
-	Value []byte
+// blockUpdater serializes blocks with their receipts and state updates, and
+// emits them as the chain progresses.
+type blockUpdater struct {
+	chain chain
+	db    database
+	feed  core.Feed
+	pl    core.PluginLoader
+
+	lock    sync.Mutex
+	last    uint64 // number of the last block emitted
+	started bool   // whether any block was emitted
 }
 
-// storage is used for RLP encoding two layers of maps, as maps cannot be RLP encoded directly
-type storage struct {
-	Account common.Hash
-	Data []kvpair
+// Initialize does initial setup of variables as the plugin is loaded.
+func Initialize(ctx *cli.Context, loader core.PluginLoader, logger core.Logger) {
+	pl = loader
+	log = logger
+	events = loader.GetFeed()
+	log.Info("Loaded block updater plugin")
 }
 
-// storedStateUpdate is an RLP encodable version of stateUpdate
-type storedStateUpdate struct {
-	Destructs []common.Hash
-	Accounts	[]kvpair
-	Storage	 []storage
+// InitializeNode is invoked by the plugin loader when the node and Backend are
+// ready. We will track the backend to provide access to blocks and to store
+// state updates in the chain database.
+func InitializeNode(stack core.Node, b restricted.Backend) {
+	updates = &blockUpdater{chain: b, db: b.ChainDb(), feed: events, pl: pl}
 }
 
-
-// MarshalJSON represents the stateUpdate as JSON for RPC calls
-func (su *stateUpdate) MarshalJSON() ([]byte, error) {
-	result := make(map[string]interface{})
-	destructs := make([]common.Hash, 0, len(su.Destructs))
-	for k := range su.Destructs {
-		destructs = append(destructs, k)
+// StateUpdate gives us updates about state changes made in each block. We
+// store them in the chain database, to serve them for any block observed.
+func StateUpdate(blockRoot, parentRoot core.Hash, destructs map[core.Hash]struct{}, accounts map[core.Hash][]byte, storage map[core.Hash]map[core.Hash][]byte, codeUpdates map[core.Hash][]byte) {
+	if updates == nil {
+		return
 	}
-	result["destructs"] = destructs
-	accounts := make(map[common.Hash]hexutil.Bytes)
-	for k, v := range su.Accounts {
-		accounts[k] = hexutil.Bytes(v)
+	su := &stateUpdate{
+		Destructs: destructs,
+		Accounts:  accounts,
+		Storage:   storage,
+		Code:      codeUpdates,
 	}
-	result["accounts"] = accounts
-	storage := make(map[common.Hash]map[common.Hash]hexutil.Bytes)
-	for m, s := range su.Storage {
-		storage[m] = make(map[common.Hash]hexutil.Bytes)
-		for k, v := range s {
-			storage[m][k] = hexutil.Bytes(v)
-		}
+	if err := writeStateUpdate(updates.db, blockRoot, parentRoot, su); err != nil {
+		log.Error("Failed to store state update", "root", blockRoot, "err", err)
 	}
-	result["storage"] = storage
-	return json.Marshal(result)
 }
 
-// EncodeRLP converts the stateUpdate to a storedStateUpdate, and RLP encodes the result for storage
-func (su *stateUpdate) EncodeRLP(w io.Writer) error {
-	destructs := make([]common.Hash, 0, len(su.Destructs))
-	for k := range su.Destructs {
-		destructs = append(destructs, k)
-	}
-	accounts := make([]kvpair, 0, len(su.Accounts))
-	for k, v := range su.Accounts {
-		accounts = append(accounts, kvpair{k, v})
+// NewHead is invoked when a new block becomes the latest recognized block. We
+// use this to notify subscribers of new blocks, as well as invoke the
+// BlockUpdates hook on downstream plugins.
+func NewHead(block []byte, hash core.Hash, logs [][]byte, td *big.Int) {
+	if updates == nil {
+		return
 	}
-	s := make([]storage, 0, len(su.Storage))
-	for a, m := range su.Storage {
-		accountStorage := storage{a, make([]kvpair, 0, len(m))}
-		for k, v := range m {
-			accountStorage.Data = append(accountStorage.Data, kvpair{k, v})
-		}
-		s = append(s, accountStorage)
+	b := new(types.Block)
+	if err := rlp.DecodeBytes(block, b); err != nil {
+		log.Error("Could not decode new head", "hash", hash, "err", err)
+		return
 	}
-	return rlp.Encode(w, storedStateUpdate{destructs, accounts, s})
+	updates.newHead(context.Background(), b)
 }
 
-// DecodeRLP takes a byte stream, decodes it to a storedStateUpdate, the n converts that into a stateUpdate object
-func (su *stateUpdate) DecodeRLP(s *rlp.Stream) error {
-	ssu := storedStateUpdate{}
-	if err := s.Decode(&ssu); err != nil { return err }
-	su.Destructs = make(map[common.Hash]struct{})
-	for _, s := range ssu.Destructs {
-		su.Destructs[s] = struct{}{}
-	}
-	su.Accounts = make(map[common.Hash][]byte)
-	for _, kv := range ssu.Accounts {
-		su.Accounts[kv.Key] = kv.Value
-	}
-	su.Storage = make(map[common.Hash]map[common.Hash][]byte)
-	for _, s := range ssu.Storage {
-		su.Storage[s.Account] = make(map[common.Hash][]byte)
-		for _, kv := range s.Data {
-			su.Storage[s.Account][kv.Key] = kv.Value
-		}
+// Reorg is invoked when the chain reorganizes, before the new head is
+// announced. The blocks of the new chain are then emitted with the new head.
+func Reorg(common core.Hash, oldChain []core.Hash, newChain []core.Hash) {
+	if updates == nil {
+		return
 	}
-	return nil
+	updates.reorg(context.Background(), common)
 }
 
-
-// Initialize does initial setup of variables as the plugin is loaded.
-func Initialize(ctx *cli.Context, loader *plugins.PluginLoader) {
-	pl = loader
-	cache, _ = lru.New(128) // TODO: Make size configurable
-	if !ctx.GlobalBool(utils.SnapshotFlag.Name) {
-		log.Warn("Snapshots are required for StateUpdate plugins, but are currently disabled. State Updates will be unavailable")
+// newHead emits the updates of the new head, preceded by those of the
+// canonical blocks since the last one emitted, missed by a reorg or skipped
+// heads.
+func (u *blockUpdater) newHead(ctx context.Context, head *types.Block) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	blocks := []*types.Block{head}
+	for u.started && len(blocks) < maxBackfill {
+		block := blocks[len(blocks)-1]
+		if block.NumberU64() <= u.last+1 {
+			break
+		}
+		parent, err := u.blockByHash(ctx, block.ParentHash())
+		if err != nil {
+			log.Warn("Could not backfill block updates", "hash", block.ParentHash(), "err", err)
+			break
+		}
+		blocks = append(blocks, parent)
 	}
-	log.Info("Loaded block updater plugin")
-}
-
-
-// InitializeNode is invoked by the plugin loader when the node and Backend are
-// ready. We will track the backend to provide access to blocks and other
-// useful information.
-func InitializeNode(stack *node.Node, b interfaces.Backend) {
-	backend = b
-}
-
-
-// StateUpdate gives us updates about state changes made in each block. We
-// cache them for short term use, and write them to disk for the longer term.
-func StateUpdate(blockRoot common.Hash, parentRoot common.Hash, destructs map[common.Hash]struct{}, accounts map[common.Hash][]byte, storage map[common.Hash]map[common.Hash][]byte) {
-	su := &stateUpdate{
-		Destructs: destructs,
-		Accounts: accounts,
-		Storage: storage,
+	for i := len(blocks) - 1; i >= 0; i-- {
+		u.emit(ctx, blocks[i])
 	}
-	cache.Add(blockRoot, su)
-	data, _ := rlp.EncodeToBytes(su)
-	backend.ChainDb().Put(append([]byte("su"), blockRoot.Bytes()...), data)
+	u.last, u.started = head.NumberU64(), true
 }
 
-// AppendAncient removes our state update records from leveldb as the
-// corresponding blocks are moved from leveldb to the ancients database. At
-// some point in the future, we may want to look at a way to move the state
-// updates to an ancients table of their own for longer term retention.
-func AppendAncient(number uint64, hash, headerBytes, body, receipts, td []byte) {
+// reorg rewinds the last block emitted to the common ancestor of a reorg.
+func (u *blockUpdater) reorg(ctx context.Context, common core.Hash) {
+	data, err := u.chain.HeaderByHash(ctx, common)
+	if err != nil {
+		log.Warn("Could not retrieve common ancestor of reorg", "hash", common, "err", err)
+		return
+	}
 	header := new(types.Header)
-	if err := rlp.Decode(bytes.NewReader(headerBytes), header); err != nil {
-		log.Warn("Could not decode ancient header", "block", number)
+	if err := rlp.DecodeBytes(data, header); err != nil {
+		log.Warn("Could not decode common ancestor of reorg", "hash", common, "err", err)
 		return
 	}
-	backend.ChainDb().Delete(append([]byte("su"), header.Root.Bytes()...))
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.started && header.Number.Uint64() < u.last {
+		u.last = header.Number.Uint64()
+	}
 }
 
-
-// NewHead is invoked when a new block becomes the latest recognized block. We
-// use this to notify the blockEvents channel of new blocks, as well as invoke
-// the BlockUpdates hook on downstream plugins.
-// TODO: We're not necessarily handling reorgs properly, which may result in
-// some blocks not being emitted through this hook.
-func NewHead(block *types.Block, hash common.Hash, logs []*types.Log) {
-	if pl == nil {
-		log.Warn("Attempting to emit NewHead, but default PluginLoader has not been initialized")
-		return
-	}
-	result, err := blockUpdates(context.Background(), block)
+// emit sends the updates of block to subscribers and downstream plugins. Blocks
+// whose updates cannot be built are announced to subscribers with the error,
+// and not passed to downstream plugins.
+func (u *blockUpdater) emit(ctx context.Context, block *types.Block) {
+	result, su, receipts, err := u.blockUpdates(ctx, block)
 	if err != nil {
+		// Subscribers are told about the blocks that cannot be serialized,
+		// rather than left with a gap in the feed.
 		log.Error("Could not serialize block", "err", err, "hash", block.Hash())
+		u.feed.Send(map[string]interface{}{
+			"hash":   block.Hash(),
+			"number": hexutil.Uint64(block.NumberU64()),
+			"error":  err.Error(),
+		})
 		return
 	}
-	blockEvents.Send(result)
+	u.feed.Send(result)
 
-	receipts, err := backend.GetReceipts(context.Background(), block.Hash())
-	var su *stateUpdate
-	if v, ok := cache.Get(block.Root()); ok {
-		su = v.(*stateUpdate)
-	} else {
-		data, err := backend.ChainDb().Get(append([]byte("su"), block.Root().Bytes()...))
-		if err != nil {
-			log.Error("StateUpdate unavailable for block", "hash", block.Hash())
-			return
-		}
-		su = &stateUpdate{}
-		if err := rlp.DecodeBytes(data, su); err != nil {
-			log.Error("StateUpdate unavailable for block", "hash", block.Hash())
-			return
+	var decoded types.Receipts
+	if err := json.Unmarshal(receipts, &decoded); err != nil {
+		log.Warn("Could not decode receipts", "hash", block.Hash(), "err", err)
+	}
+	fnList := u.pl.Lookup("BlockUpdates", func(item interface{}) bool {
+		_, ok := item.(func(*types.Block, types.Receipts, map[core.Hash]struct{}, map[core.Hash][]byte, map[core.Hash]map[core.Hash][]byte, map[core.Hash][]byte))
+		return ok
+	})
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(*types.Block, types.Receipts, map[core.Hash]struct{}, map[core.Hash][]byte, map[core.Hash]map[core.Hash][]byte, map[core.Hash][]byte)); ok {
+			fn(block, decoded, su.Destructs, su.Accounts, su.Storage, su.Code)
 		}
 	}
-	fnList := pl.Lookup("BlockUpdates", func(item interface{}) bool {
-    _, ok := item.(func(*types.Block, []*types.Log, types.Receipts, map[common.Hash]struct{}, map[common.Hash][]byte, map[common.Hash]map[common.Hash][]byte))
-    return ok
-  })
-  for _, fni := range fnList {
-    if fn, ok := fni.(func(*types.Block, []*types.Log, types.Receipts, map[common.Hash]struct{}, map[common.Hash][]byte, map[common.Hash]map[common.Hash][]byte)); ok {
-      fn(block, logs, receipts, su.Destructs, su.Accounts, su.Storage)
-    }
-  }
 }
 
-
-// BlockUpdates is a service that lets clients query for block updates for a
-// given block by hash or number, or subscribe to new block upates.
-type BlockUpdates struct{
-	backend interfaces.Backend
-}
-
-// blockUpdate handles the serialization of a block
-func blockUpdates(ctx context.Context, block *types.Block) (map[string]interface{}, error)	{
-	result, err := ethapi.RPCMarshalBlock(block, true, true)
-	if err != nil { return nil, err }
-	result["receipts"], err = backend.GetReceipts(ctx, block.Hash())
-	if err != nil { return nil, err }
-	if v, ok := cache.Get(block.Root()); ok {
-		result["stateUpdates"] = v
-		return result, nil
+func (u *blockUpdater) blockByHash(ctx context.Context, hash core.Hash) (*types.Block, error) {
+	data, err := u.chain.BlockByHash(ctx, hash)
+	if err != nil {
+		return nil, err
 	}
-	data, err := backend.ChainDb().Get(append([]byte("su"), block.Root().Bytes()...))
-	if err != nil { return nil, fmt.Errorf("State Updates unavailable for block %#x", block.Hash())}
-	su := &stateUpdate{}
-	if err := rlp.DecodeBytes(data, su); err != nil { return nil, fmt.Errorf("State updates unavailable for block %#x", block.Hash()) }
-	result["stateUpdates"] = su
-	return result, nil
+	return decodeBlock(data)
 }
 
-// BlockUpdatesByNumber retrieves a block by number, gets receipts and state
-// updates, and serializes the response.
-func (b *BlockUpdates) BlockUpdatesByNumber(ctx context.Context, number rpc.BlockNumber) (map[string]interface{}, error) {
-	block, err := b.backend.BlockByNumber(ctx, number)
-	if err != nil { return nil, err }
-	return blockUpdates(ctx, block)
+func (u *blockUpdater) blockByNumber(ctx context.Context, number int64) (*types.Block, error) {
+	data, err := u.chain.BlockByNumber(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return decodeBlock(data)
 }
 
-// BlockUpdatesByHash retrieves a block by hash, gets receipts and state
-// updates, and serializes the response.
-func (b *BlockUpdates) BlockUpdatesByHash(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
-	block, err := b.backend.BlockByHash(ctx, hash)
-	if err != nil { return nil, err }
-	return blockUpdates(ctx, block)
+func decodeBlock(data []byte) (*types.Block, error) {
+	block := new(types.Block)
+	if err := rlp.DecodeBytes(data, block); err != nil {
+		return nil, errors.New("block not found")
+	}
+	return block, nil
 }
 
-// BlockUpdates allows clients to subscribe to notifications of new blocks
-// along with receipts and state updates.
-func (b *BlockUpdates) BlockUpdates(ctx context.Context) (*rpc.Subscription, error) {
-	notifier, supported := rpc.NotifierFromContext(ctx)
-	if !supported {
-		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+// blockUpdates serializes a block with its receipts and state update. State
+// updates of blocks not processed while the plugin was loaded are computed from
+// the state tries, and stored for later requests.
+func (u *blockUpdater) blockUpdates(ctx context.Context, block *types.Block) (map[string]interface{}, *stateUpdate, json.RawMessage, error) {
+	parentRoot := emptyRoot
+	if block.NumberU64() > 0 {
+		data, err := u.chain.HeaderByHash(ctx, block.ParentHash())
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		parent := new(types.Header)
+		if err := rlp.DecodeBytes(data, parent); err != nil {
+			return nil, nil, nil, err
+		}
+		parentRoot = parent.Root
 	}
-
-	var (
-		rpcSub = notifier.CreateSubscription()
-		blockDataChan = make(chan map[string]interface{}, 1000)
-	)
-
-	sub := blockEvents.Subscribe(blockDataChan)
-	go func() {
-
-		for {
-			select {
-			case b := <-blockDataChan:
-				notifier.Notify(rpcSub.ID, b)
-			case <-rpcSub.Err(): // client send an unsubscribe request
-				sub.Unsubscribe()
-				return
-			case <-notifier.Closed(): // connection dropped
-				sub.Unsubscribe()
-				return
-			}
+	su, err := readStateUpdate(u.db, block.Root(), parentRoot)
+	if err != nil {
+		if su, err = computeStateUpdate(u.db, block.Root(), parentRoot); err != nil {
+			return nil, nil, nil, fmt.Errorf("state updates unavailable for block %#x: %v", block.Hash(), err)
 		}
-	}()
-
-	return rpcSub, nil
-}
-
-
-// GetAPIs exposes the BlockUpdates service under the cardinal namespace.
-func GetAPIs(stack *node.Node, backend interfaces.Backend) []rpc.API {
-	return []rpc.API{
-	 {
-		 Namespace: "cardinal",
-		 Version:	 "1.0",
-		 Service:	 &BlockUpdates{backend},
-		 Public:		true,
-	 },
- }
+		if err := writeStateUpdate(u.db, block.Root(), parentRoot, su); err != nil {
+			log.Warn("Failed to store state update", "root", block.Root(), "err", err)
+		}
+	}
+	receipts, err := u.chain.GetReceipts(ctx, block.Hash())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	header, err := json.Marshal(block.Header())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	result := make(map[string]interface{})
+	if err := json.Unmarshal(header, &result); err != nil {
+		return nil, nil, nil, err
+	}
+	uncles := make([]core.Hash, len(block.Uncles()))
+	for i, uncle := range block.Uncles() {
+		uncles[i] = uncle.Hash()
+	}
+	result["hash"] = block.Hash()
+	result["transactions"] = block.Transactions()
+	result["uncles"] = uncles
+	result["receipts"] = json.RawMessage(receipts)
+	result["stateUpdates"] = su
+	return result, su, receipts, nil
 }
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted/crypto"
+	"github.com/openrelayxyz/plugeth-utils/restricted/rlp"
+	"github.com/openrelayxyz/plugeth-utils/restricted/types"
+)
+
+type testDatabase map[string][]byte
+
+func (db testDatabase) Get(key []byte) ([]byte, error) {
+	if v, ok := db[string(key)]; ok {
+		return v, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (db testDatabase) Put(key []byte, value []byte) error {
+	db[string(key)] = value
+	return nil
+}
+
+// testChain serves the blocks it holds, the canonical ones by number.
+type testChain struct {
+	blocks    map[core.Hash]*types.Block
+	canonical map[int64]*types.Block
+}
+
+func (c *testChain) add(parent *types.Block, root core.Hash, canonical bool) *types.Block {
+	header := &types.Header{Number: big.NewInt(0), Difficulty: big.NewInt(1), Root: root}
+	if parent != nil {
+		header.ParentHash = parent.Hash()
+		header.Number = new(big.Int).Add(parent.Number(), big.NewInt(1))
+		header.Extra = []byte{byte(len(c.blocks))}
+	}
+	block := types.NewBlockWithHeader(header)
+	c.blocks[block.Hash()] = block
+	if canonical {
+		c.canonical[block.Number().Int64()] = block
+	}
+	return block
+}
+
+func (c *testChain) BlockByNumber(ctx context.Context, number int64) ([]byte, error) {
+	return rlp.EncodeToBytes(c.canonical[number])
+}
+
+func (c *testChain) BlockByHash(ctx context.Context, hash core.Hash) ([]byte, error) {
+	return rlp.EncodeToBytes(c.blocks[hash])
+}
+
+func (c *testChain) HeaderByHash(ctx context.Context, hash core.Hash) ([]byte, error) {
+	if block, ok := c.blocks[hash]; ok {
+		return rlp.EncodeToBytes(block.Header())
+	}
+	return nil, errors.New("not found")
+}
+
+func (c *testChain) GetReceipts(ctx context.Context, hash core.Hash) ([]byte, error) {
+	return []byte("[]"), nil
+}
+
+type testFeed struct {
+	sent []map[string]interface{}
+}
+
+func (f *testFeed) Send(v interface{}) int {
+	f.sent = append(f.sent, v.(map[string]interface{}))
+	return 1
+}
+
+func (f *testFeed) Subscribe(ch interface{}) core.Subscription { return nil }
+
+type testLoader struct{}
+
+func (testLoader) Lookup(name string, validate func(interface{}) bool) []interface{} { return nil }
+func (testLoader) GetFeed() core.Feed                                                { return new(testFeed) }
+
+type testLogger struct{ t *testing.T }
+
+func (l testLogger) Trace(msg string, ctx ...interface{}) {}
+func (l testLogger) Debug(msg string, ctx ...interface{}) {}
+func (l testLogger) Info(msg string, ctx ...interface{})  {}
+func (l testLogger) Warn(msg string, ctx ...interface{}) {
+	l.t.Log(append([]interface{}{msg}, ctx...)...)
+}
+func (l testLogger) Crit(msg string, ctx ...interface{}) {
+	l.t.Log(append([]interface{}{msg}, ctx...)...)
+}
+func (l testLogger) Error(msg string, ctx ...interface{}) {
+	l.t.Log(append([]interface{}{msg}, ctx...)...)
+}
+
+func TestStateUpdateStore(t *testing.T) {
+	db := make(testDatabase)
+	su := &stateUpdate{
+		Destructs: map[core.Hash]struct{}{{0x01}: {}},
+		Accounts:  map[core.Hash][]byte{{0x02}: {0x02}, {0x03}: {0x03}},
+		Storage:   map[core.Hash]map[core.Hash][]byte{{0x02}: {{0x04}: {0x04}}},
+		Code:      map[core.Hash][]byte{{0x05}: {0x05}},
+	}
+	if err := writeStateUpdate(db, core.Hash{0xaa}, core.Hash{0xbb}, su); err != nil {
+		t.Fatalf("Failed to write state update: %v", err)
+	}
+	stored, err := readStateUpdate(db, core.Hash{0xaa}, core.Hash{0xbb})
+	if err != nil {
+		t.Fatalf("Failed to read state update: %v", err)
+	}
+	if len(stored.Destructs) != 1 || len(stored.Accounts) != 2 || stored.Storage[core.Hash{0x02}][core.Hash{0x04}][0] != 0x04 || stored.Code[core.Hash{0x05}][0] != 0x05 {
+		t.Errorf("Unexpected stored state update %+v", stored)
+	}
+	if _, err := readStateUpdate(db, core.Hash{0xaa}, core.Hash{0xcc}); err == nil {
+		t.Errorf("Expected updates to be keyed by parent root")
+	}
+	if empty, err := readStateUpdate(db, core.Hash{0xcc}, core.Hash{0xcc}); err != nil || len(empty.Accounts) != 0 {
+		t.Errorf("Expected an empty update for unchanged state, got %v, %v", empty, err)
+	}
+}
+
+func TestNewHeadBackfill(t *testing.T) {
+	log = testLogger{t}
+	var (
+		chain = &testChain{blocks: make(map[core.Hash]*types.Block), canonical: make(map[int64]*types.Block)}
+		feed  = new(testFeed)
+		db    = make(testDatabase)
+		u     = &blockUpdater{chain: chain, db: db, feed: feed, pl: testLoader{}}
+	)
+	// Blocks 1-3, with a side chain 2'-4' forking from block 1
+	blocks := []*types.Block{chain.add(nil, core.Hash{0x00}, true)}
+	for i := 1; i <= 3; i++ {
+		blocks = append(blocks, chain.add(blocks[i-1], core.Hash{byte(i)}, true))
+	}
+	side := []*types.Block{blocks[1]}
+	for i := 2; i <= 4; i++ {
+		side = append(side, chain.add(side[len(side)-1], core.Hash{byte(i), 0x01}, false))
+	}
+	for _, chain := range [][]*types.Block{blocks, side} {
+		for i := 1; i < len(chain); i++ {
+			writeStateUpdate(db, chain[i].Root(), chain[i-1].Root(), &stateUpdate{Accounts: map[core.Hash][]byte{chain[i].Root(): nil}})
+		}
+	}
+	emitted := func() (numbers []uint64) {
+		for _, result := range feed.sent {
+			numbers = append(numbers, uint64(result["number"].(string)[2]-'0'))
+		}
+		feed.sent = nil
+		return numbers
+	}
+	ctx := context.Background()
+
+	u.newHead(ctx, blocks[1])
+	// Skipped heads are backfilled
+	u.newHead(ctx, blocks[3])
+	if got := emitted(); len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 3 {
+		t.Fatalf("Unexpected emitted blocks %v", got)
+	}
+	// The new chain of a reorg is emitted from the common ancestor
+	for i := 2; i <= 4; i++ {
+		chain.canonical[int64(i)] = side[i-1]
+	}
+	u.reorg(ctx, blocks[1].Hash())
+	u.newHead(ctx, side[3])
+	if got := emitted(); len(got) != 3 || got[0] != 2 || got[2] != 4 {
+		t.Fatalf("Unexpected emitted blocks after reorg %v", got)
+	}
+	// Historical blocks are served by number from the stored updates
+	api := &BlockUpdates{u}
+	result, err := api.BlockUpdatesByNumber(ctx, 2)
+	if err != nil {
+		t.Fatalf("Failed to retrieve block updates: %v", err)
+	}
+	if result["hash"] != side[1].Hash() {
+		t.Errorf("Expected the updates of the canonical block")
+	}
+	if _, ok := result["stateUpdates"].(*stateUpdate).Accounts[side[1].Root()]; !ok {
+		t.Errorf("Unexpected state updates %v", result["stateUpdates"])
+	}
+}
+
+// writeTrie stores the trie holding entries in db, the way geth does, and
+// returns its root.
+func writeTrie(db testDatabase, entries map[core.Hash][]byte) core.Hash {
+	if len(entries) == 0 {
+		return emptyRoot
+	}
+	keys := make([][]byte, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, keyToNibbles(k[:]))
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	enc := encodeTrie(db, keys, entries, 0)
+	root := crypto.Keccak256Hash(enc)
+	db[string(root[:])] = enc
+	return root
+}
+
+func encodeTrie(db testDatabase, keys [][]byte, entries map[core.Hash][]byte, depth int) []byte {
+	ref := func(enc []byte) rlp.RawValue {
+		if len(enc) < 32 {
+			return enc
+		}
+		hash := crypto.Keccak256(enc)
+		db[string(hash)] = enc
+		data, _ := rlp.EncodeToBytes(hash)
+		return data
+	}
+	if len(keys) == 1 {
+		value := entries[core.BytesToHash(nibblesToKey(keys[0]))]
+		enc, _ := rlp.EncodeToBytes([]interface{}{nibblesToCompact(keys[0][depth:], true), value})
+		return enc
+	}
+	prefix := depth
+	for ; prefix < len(keys[0]); prefix++ {
+		if keys[0][prefix] != keys[len(keys)-1][prefix] {
+			break
+		}
+	}
+	if prefix > depth {
+		enc, _ := rlp.EncodeToBytes([]interface{}{nibblesToCompact(keys[0][depth:prefix], false), ref(encodeTrie(db, keys, entries, prefix))})
+		return enc
+	}
+	node := make([]interface{}, 17)
+	for i := range node {
+		node[i] = []byte{}
+	}
+	for start := 0; start < len(keys); {
+		end := start + 1
+		for end < len(keys) && keys[end][depth] == keys[start][depth] {
+			end++
+		}
+		node[keys[start][depth]] = ref(encodeTrie(db, keys[start:end], entries, depth+1))
+		start = end
+	}
+	enc, _ := rlp.EncodeToBytes(node)
+	return enc
+}
+
+func keyToNibbles(key []byte) []byte {
+	nibbles := make([]byte, 0, 2*len(key))
+	for _, b := range key {
+		nibbles = append(nibbles, b>>4, b&0x0f)
+	}
+	return nibbles
+}
+
+func nibblesToCompact(nibbles []byte, leaf bool) []byte {
+	var flags byte
+	if leaf {
+		flags = 2
+	}
+	compact := []byte{flags << 4}
+	if len(nibbles)%2 == 1 {
+		compact[0] |= (1 << 4) | nibbles[0]
+		nibbles = nibbles[1:]
+	}
+	return append(compact, nibblesToKey(nibbles)...)
+}
+
+// writeAccount stores the storage and code of an account, returning its
+// encoding in the state trie.
+func writeAccount(db testDatabase, nonce uint64, storage map[core.Hash][]byte, code []byte) []byte {
+	codeHash := emptyCodeHash[:]
+	if code != nil {
+		codeHash = crypto.Keccak256(code)
+		db[string(append(append([]byte{}, codePrefix...), codeHash...))] = code
+	}
+	data, _ := rlp.EncodeToBytes(stateAccount{Nonce: nonce, Balance: big.NewInt(1), Root: writeTrie(db, storage), CodeHash: codeHash})
+	return data
+}
+
+func TestComputeStateUpdate(t *testing.T) {
+	db := make(testDatabase)
+	var (
+		changed   = core.Hash{0x11}
+		storage   = core.Hash{0x12, 0x01}
+		destroyed = core.Hash{0x12, 0x02}
+		created   = core.Hash{0xf0}
+		untouched = core.Hash{0x13}
+		code      = []byte{0x60, 0x00}
+	)
+	parentState := map[core.Hash][]byte{
+		changed:   writeAccount(db, 1, nil, nil),
+		storage:   writeAccount(db, 1, map[core.Hash][]byte{{0x01}: {0x01}, {0x02}: {0x02}}, code),
+		destroyed: writeAccount(db, 1, nil, nil),
+		untouched: writeAccount(db, 1, map[core.Hash][]byte{{0x01}: {0x01}}, nil),
+	}
+	// The root geth computes for the same state
+	parent := writeTrie(db, parentState)
+	if parent != core.HexToHash("e4a0286cc6c8d315d13e076243b82e55b2192ad20d518635128302aaf09c4ad7") {
+		t.Fatalf("Unexpected state root %v", parent)
+	}
+	state := map[core.Hash][]byte{
+		changed:   writeAccount(db, 2, nil, nil),
+		storage:   writeAccount(db, 1, map[core.Hash][]byte{{0x01}: {0x01}, {0x02}: {0x03}, {0x03}: {0x04}}, code),
+		created:   writeAccount(db, 0, nil, []byte{0x00}),
+		untouched: parentState[untouched],
+	}
+	root := writeTrie(db, state)
+
+	su, err := computeStateUpdate(db, root, parent)
+	if err != nil {
+		t.Fatalf("Failed to compute state update: %v", err)
+	}
+	if _, ok := su.Destructs[destroyed]; len(su.Destructs) != 1 || !ok {
+		t.Errorf("Unexpected destructs %v", su.Destructs)
+	}
+	if len(su.Accounts) != 3 || su.Accounts[untouched] != nil {
+		t.Errorf("Unexpected updated accounts %v", su.Accounts)
+	}
+	var account slimAccount
+	if err := rlp.DecodeBytes(su.Accounts[changed], &account); err != nil || account.Nonce != 2 || len(account.Root) != 0 || len(account.CodeHash) != 0 {
+		t.Errorf("Unexpected slim account %+v, %v", account, err)
+	}
+	if slots := su.Storage[storage]; len(su.Storage) != 1 || len(slots) != 2 || slots[core.Hash{0x02}][0] != 0x03 || slots[core.Hash{0x03}][0] != 0x04 {
+		t.Errorf("Unexpected storage updates %v", su.Storage)
+	}
+	if len(su.Code) != 1 || su.Code[crypto.Keccak256Hash([]byte{0x00})] == nil {
+		t.Errorf("Unexpected code updates %v", su.Code)
+	}
+
+	// Genesis states are compared to the empty state
+	genesis, err := computeStateUpdate(db, parent, emptyRoot)
+	if err != nil || len(genesis.Accounts) != len(parentState) || len(genesis.Storage) != 2 || len(genesis.Code) != 1 {
+		t.Errorf("Unexpected genesis state update %+v, %v", genesis, err)
+	}
+	// Missing state is reported
+	delete(db, string(root[:]))
+	if _, err := computeStateUpdate(db, root, parent); err == nil {
+		t.Errorf("Expected missing state to be reported")
+	}
+}
+
+func TestBlockUpdatesOnDemand(t *testing.T) {
+	log = testLogger{t}
+	var (
+		chain = &testChain{blocks: make(map[core.Hash]*types.Block), canonical: make(map[int64]*types.Block)}
+		feed  = new(testFeed)
+		db    = make(testDatabase)
+		u     = &blockUpdater{chain: chain, db: db, feed: feed, pl: testLoader{}}
+		ctx   = context.Background()
+	)
+	genesisRoot := writeTrie(db, map[core.Hash][]byte{{0x01}: writeAccount(db, 0, nil, nil)})
+	root := writeTrie(db, map[core.Hash][]byte{{0x01}: writeAccount(db, 1, nil, nil)})
+	genesis := chain.add(nil, genesisRoot, true)
+	block := chain.add(genesis, root, true)
+	missing := chain.add(block, core.Hash{0xff}, true)
+
+	// State updates missing from the database are computed and stored
+	u.newHead(ctx, genesis)
+	u.newHead(ctx, block)
+	if len(feed.sent) != 2 || feed.sent[0]["stateUpdates"].(*stateUpdate).Accounts[core.Hash{0x01}] == nil || feed.sent[1]["stateUpdates"].(*stateUpdate).Accounts[core.Hash{0x01}] == nil {
+		t.Fatalf("Unexpected emitted updates %v", feed.sent)
+	}
+	if _, err := readStateUpdate(db, root, genesisRoot); err != nil {
+		t.Errorf("Expected the computed state update to be stored: %v", err)
+	}
+	// Blocks whose updates cannot be built are announced with the error
+	feed.sent = nil
+	u.newHead(ctx, missing)
+	if len(feed.sent) != 1 || feed.sent[0]["hash"] != missing.Hash() || feed.sent[0]["error"] == nil {
+		t.Fatalf("Expected an error notification, got %v", feed.sent)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted/rlp"
+)
+
+// The state updates of blocks not processed while the plugin was loaded are
+// computed on demand, by comparing the state tries of the block and of its
+// parent as stored in the chain database. This needs the state of both blocks
+// to have been written to disk, as it is for every block by archive nodes.
+
+var (
+	emptyRoot     = core.HexToHash("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+	emptyCodeHash = core.HexToHash("c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470")
+
+	// codePrefix + code hash -> contract code, as in the chain database
+	codePrefix = []byte("c")
+)
+
+// stateAccount is an account as stored in the state trie.
+type stateAccount struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     core.Hash
+	CodeHash []byte
+}
+
+// slimAccount is an account as delivered by StateUpdate, with the empty
+// storage root and code hash left out.
+type slimAccount struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     []byte
+	CodeHash []byte
+}
+
+// computeStateUpdate builds the state update of the transition from the parent
+// root to root from their state tries. Accounts deleted by the transition are
+// reported as destructed; accounts destructed and recreated by it are not,
+// their storage update clearing the slots they no longer hold instead.
+func computeStateUpdate(db database, root, parent core.Hash) (*stateUpdate, error) {
+	su := newStateUpdate()
+	err := diffTries(db, trieRoot(parent), trieRoot(root), func(key, before, after []byte) error {
+		hash := core.BytesToHash(key)
+		if after == nil {
+			su.Destructs[hash] = struct{}{}
+			return nil
+		}
+		prev := stateAccount{Root: emptyRoot, CodeHash: emptyCodeHash[:]}
+		if before != nil {
+			if err := rlp.DecodeBytes(before, &prev); err != nil {
+				return err
+			}
+		}
+		var account stateAccount
+		if err := rlp.DecodeBytes(after, &account); err != nil {
+			return err
+		}
+		slim := slimAccount{Nonce: account.Nonce, Balance: account.Balance}
+		if account.Root != emptyRoot {
+			slim.Root = account.Root[:]
+		}
+		if !bytes.Equal(account.CodeHash, emptyCodeHash[:]) {
+			slim.CodeHash = account.CodeHash
+		}
+		data, err := rlp.EncodeToBytes(slim)
+		if err != nil {
+			return err
+		}
+		su.Accounts[hash] = data
+
+		if account.Root != prev.Root {
+			storage := make(map[core.Hash][]byte)
+			err := diffTries(db, trieRoot(prev.Root), trieRoot(account.Root), func(key, before, after []byte) error {
+				storage[core.BytesToHash(key)] = after
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			su.Storage[hash] = storage
+		}
+		if slim.CodeHash != nil && !bytes.Equal(account.CodeHash, prev.CodeHash) {
+			codeHash := core.BytesToHash(account.CodeHash)
+			code, err := db.Get(append(append([]byte{}, codePrefix...), codeHash[:]...))
+			if err != nil {
+				if code, err = db.Get(codeHash[:]); err != nil { // Legacy code scheme
+					return fmt.Errorf("missing code %#x", codeHash)
+				}
+			}
+			su.Code[codeHash] = code
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return su, nil
+}
+
+// trieNode is a node of a trie, in a form suited to comparing tries. Branch
+// nodes have children, extension nodes a key and the next node, and leaves a
+// key and a value. Keys are in nibbles.
+type trieNode struct {
+	children [16]*trieRef
+	key      []byte
+	next     *trieRef
+	value    []byte
+}
+
+// trieRef references a node, by the hash it is stored under, or decoded.
+type trieRef struct {
+	hash []byte
+	node *trieNode
+}
+
+func trieRoot(root core.Hash) *trieRef {
+	if root == emptyRoot {
+		return nil
+	}
+	return &trieRef{hash: core.CopyBytes(root[:])}
+}
+
+// diffTries calls fn with the key and values of every leaf differing between
+// the tries a and b, in key order, with nil values for missing leaves.
+// Subtries stored under the same hash are skipped.
+func diffTries(db database, a, b *trieRef, fn func(key, before, after []byte) error) error {
+	return diffNodes(db, a, b, nil, fn)
+}
+
+func diffNodes(db database, a, b *trieRef, path []byte, fn func(key, before, after []byte) error) error {
+	if a == nil && b == nil {
+		return nil
+	}
+	if a != nil && b != nil && a.hash != nil && bytes.Equal(a.hash, b.hash) {
+		return nil
+	}
+	va, ca, err := expandNode(db, a)
+	if err != nil {
+		return err
+	}
+	vb, cb, err := expandNode(db, b)
+	if err != nil {
+		return err
+	}
+	// State tries have keys of a fixed length, values are only found at the
+	// end of the path.
+	if va != nil || vb != nil {
+		if !bytes.Equal(va, vb) {
+			return fn(nibblesToKey(path), va, vb)
+		}
+		return nil
+	}
+	for i := range ca {
+		if err := diffNodes(db, ca[i], cb[i], append(path[:len(path):len(path)], byte(i)), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expandNode returns the value held by the referenced node, or its children
+// by the next nibble of their keys.
+func expandNode(db database, ref *trieRef) ([]byte, [16]*trieRef, error) {
+	var children [16]*trieRef
+	for ref != nil {
+		n := ref.node
+		if n == nil {
+			data, err := db.Get(ref.hash)
+			if err != nil {
+				return nil, children, fmt.Errorf("missing trie node %#x", ref.hash)
+			}
+			if n, err = decodeNode(data); err != nil {
+				return nil, children, err
+			}
+		}
+		switch {
+		case len(n.key) > 0:
+			children[n.key[0]] = &trieRef{node: &trieNode{key: n.key[1:], next: n.next, value: n.value}}
+			return nil, children, nil
+		case n.value != nil:
+			return n.value, children, nil
+		case n.next != nil:
+			ref = n.next
+		default:
+			return nil, n.children, nil
+		}
+	}
+	return nil, children, nil
+}
+
+var errInvalidNode = errors.New("invalid trie node")
+
+func decodeNode(data []byte) (*trieNode, error) {
+	elems, _, err := rlp.SplitList(data)
+	if err != nil {
+		return nil, err
+	}
+	count, err := rlp.CountValues(elems)
+	if err != nil {
+		return nil, err
+	}
+	n := new(trieNode)
+	switch count {
+	case 2:
+		compact, rest, err := rlp.SplitString(elems)
+		if err != nil {
+			return nil, err
+		}
+		var leaf bool
+		n.key, leaf = compactToNibbles(compact)
+		if leaf {
+			if n.value, _, err = rlp.SplitString(rest); err != nil {
+				return nil, err
+			}
+		} else if n.next, _, err = decodeRef(rest); err != nil {
+			return nil, err
+		} else if n.next == nil {
+			return nil, errInvalidNode
+		}
+	case 17:
+		for i := range n.children {
+			if n.children[i], elems, err = decodeRef(elems); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, errInvalidNode
+	}
+	return n, nil
+}
+
+// decodeRef decodes a reference to a child node, nil for empty ones.
+func decodeRef(buf []byte) (*trieRef, []byte, error) {
+	kind, val, rest, err := rlp.Split(buf)
+	if err != nil {
+		return nil, buf, err
+	}
+	switch {
+	case kind == rlp.List:
+		n, err := decodeNode(buf[:len(buf)-len(rest)])
+		return &trieRef{node: n}, rest, err
+	case kind == rlp.String && len(val) == 0:
+		return nil, rest, nil
+	case kind == rlp.String && len(val) == len(core.Hash{}):
+		return &trieRef{hash: val}, rest, nil
+	}
+	return nil, rest, errInvalidNode
+}
+
+// compactToNibbles decodes a key in hex prefix encoding, reporting whether it
+// is the key of a leaf.
+func compactToNibbles(compact []byte) ([]byte, bool) {
+	if len(compact) == 0 {
+		return nil, false
+	}
+	flags := compact[0] >> 4
+	nibbles := make([]byte, 0, 2*len(compact))
+	if flags&1 != 0 {
+		nibbles = append(nibbles, compact[0]&0x0f)
+	}
+	for _, b := range compact[1:] {
+		nibbles = append(nibbles, b>>4, b&0x0f)
+	}
+	return nibbles, flags&2 != 0
+}
+
+func nibblesToKey(nibbles []byte) []byte {
+	key := make([]byte, len(nibbles)/2)
+	for i := range key {
+		key[i] = nibbles[2*i]<<4 | nibbles[2*i+1]
+	}
+	return key
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted/hexutil"
+	"github.com/openrelayxyz/plugeth-utils/restricted/rlp"
+)
+
+// stateUpdatePrefix + block root + parent root -> RLP encoded stateUpdate. Keying
+// updates by both roots makes them independent of the canonical chain, so they
+// survive reorgs, and tells apart blocks reaching the same state from different
+// parents.
+var stateUpdatePrefix = []byte("plugeth-blockupdates-su")
+
+// database is the part of the chain database the plugin stores updates in.
+type database interface {
+	Get(key []byte) ([]byte, error)
+	Put(key []byte, value []byte) error
+}
+
+// stateUpdate holds the state changes made by a block
+type stateUpdate struct {
+	Destructs map[core.Hash]struct{}
+	Accounts  map[core.Hash][]byte
+	Storage   map[core.Hash]map[core.Hash][]byte
+	Code      map[core.Hash][]byte
+}
+
+// kvpair is used for RLP encoding of maps, as maps cannot be RLP encoded directly
+type kvpair struct {
+	Key   core.Hash
+	Value []byte
+}
+
+// storage is used for RLP encoding two layers of maps, as maps cannot be RLP encoded directly
+type storage struct {
+	Account core.Hash
+	Data    []kvpair
+}
+
+// storedStateUpdate is an RLP encodable version of stateUpdate
+type storedStateUpdate struct {
+	Destructs []core.Hash
+	Accounts  []kvpair
+	Storage   []storage
+	Code      []kvpair
+}
+
+// MarshalJSON represents the stateUpdate as JSON for RPC calls
+func (su *stateUpdate) MarshalJSON() ([]byte, error) {
+	result := make(map[string]interface{})
+	destructs := make([]core.Hash, 0, len(su.Destructs))
+	for k := range su.Destructs {
+		destructs = append(destructs, k)
+	}
+	sortHashes(destructs)
+	result["destructs"] = destructs
+	result["accounts"] = hexMap(su.Accounts)
+	storage := make(map[core.Hash]map[core.Hash]hexutil.Bytes)
+	for m, s := range su.Storage {
+		storage[m] = hexMap(s)
+	}
+	result["storage"] = storage
+	result["code"] = hexMap(su.Code)
+	return json.Marshal(result)
+}
+
+func hexMap(m map[core.Hash][]byte) map[core.Hash]hexutil.Bytes {
+	result := make(map[core.Hash]hexutil.Bytes, len(m))
+	for k, v := range m {
+		result[k] = hexutil.Bytes(v)
+	}
+	return result
+}
+
+// EncodeRLP converts the stateUpdate to a storedStateUpdate, sorted so the
+// encoding is deterministic, and RLP encodes the result for storage
+func (su *stateUpdate) EncodeRLP(w io.Writer) error {
+	destructs := make([]core.Hash, 0, len(su.Destructs))
+	for k := range su.Destructs {
+		destructs = append(destructs, k)
+	}
+	sortHashes(destructs)
+	s := make([]storage, 0, len(su.Storage))
+	for a, m := range su.Storage {
+		s = append(s, storage{a, kvpairs(m)})
+	}
+	sort.Slice(s, func(i, j int) bool { return bytes.Compare(s[i].Account[:], s[j].Account[:]) < 0 })
+	return rlp.Encode(w, storedStateUpdate{destructs, kvpairs(su.Accounts), s, kvpairs(su.Code)})
+}
+
+func kvpairs(m map[core.Hash][]byte) []kvpair {
+	result := make([]kvpair, 0, len(m))
+	for k, v := range m {
+		result = append(result, kvpair{k, v})
+	}
+	sort.Slice(result, func(i, j int) bool { return bytes.Compare(result[i].Key[:], result[j].Key[:]) < 0 })
+	return result
+}
+
+func sortHashes(hashes []core.Hash) {
+	sort.Slice(hashes, func(i, j int) bool { return bytes.Compare(hashes[i][:], hashes[j][:]) < 0 })
+}
+
+// DecodeRLP takes a byte stream, decodes it to a storedStateUpdate, then converts that into a stateUpdate object
+func (su *stateUpdate) DecodeRLP(s *rlp.Stream) error {
+	ssu := storedStateUpdate{}
+	if err := s.Decode(&ssu); err != nil {
+		return err
+	}
+	*su = *newStateUpdate()
+	for _, s := range ssu.Destructs {
+		su.Destructs[s] = struct{}{}
+	}
+	for _, kv := range ssu.Accounts {
+		su.Accounts[kv.Key] = kv.Value
+	}
+	for _, s := range ssu.Storage {
+		su.Storage[s.Account] = make(map[core.Hash][]byte)
+		for _, kv := range s.Data {
+			su.Storage[s.Account][kv.Key] = kv.Value
+		}
+	}
+	for _, kv := range ssu.Code {
+		su.Code[kv.Key] = kv.Value
+	}
+	return nil
+}
+
+func newStateUpdate() *stateUpdate {
+	return &stateUpdate{
+		Destructs: make(map[core.Hash]struct{}),
+		Accounts:  make(map[core.Hash][]byte),
+		Storage:   make(map[core.Hash]map[core.Hash][]byte),
+		Code:      make(map[core.Hash][]byte),
+	}
+}
+
+func stateUpdateKey(root, parent core.Hash) []byte {
+	key := append(append([]byte{}, stateUpdatePrefix...), root[:]...)
+	return append(key, parent[:]...)
+}
+
+// writeStateUpdate stores the state update of the transition from the parent
+// root to root.
+func writeStateUpdate(db database, root, parent core.Hash, su *stateUpdate) error {
+	data, err := rlp.EncodeToBytes(su)
+	if err != nil {
+		return err
+	}
+	return db.Put(stateUpdateKey(root, parent), data)
+}
+
+// readStateUpdate retrieves the state update of the transition from the parent
+// root to root. Blocks leaving the state unchanged have an empty update.
+func readStateUpdate(db database, root, parent core.Hash) (*stateUpdate, error) {
+	if root == parent {
+		return newStateUpdate(), nil
+	}
+	data, err := db.Get(stateUpdateKey(root, parent))
+	if err != nil {
+		return nil, err
+	}
+	su := new(stateUpdate)
+	if err := rlp.DecodeBytes(data, su); err != nil {
+		return nil, err
+	}
+	return su, nil
+}
@@ -10,6 +10,8 @@ import (
 	"plugin"
 	"reflect"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
@@ -18,27 +20,222 @@ import (
 
 type Subcommand func(*cli.Context, []string) error
 
+// symbolSource is implemented by *plugin.Plugin and by plugins running in
+// their own process.
+type symbolSource interface {
+	Lookup(name string) (plugin.Symbol, error)
+}
+
 type pluginDetails struct {
-	p *plugin.Plugin
-	name string
+	p        symbolSource
+	name     string
+	file     string
+	manifest *Manifest
+	priority int
+	flags    *flag.FlagSet
+	provides map[string]struct{} // hooks exported, less those Lookup found not to match
+	health   *pluginHealth
+	queue    *hookQueue // nil unless hooks are delivered asynchronously
+}
+
+// Config holds the settings of the plugin loader. Plugins are named either by
+// their file name (with or without extension) or by the name in their
+// manifest. Disabling shared object plugins by file name is preferable, as it
+// lets the loader skip them without opening them.
+type Config struct {
+	// Dir is the directory plugins are loaded from.
+	Dir string
+	// Enable lists the plugins to load. If empty, every plugin in Dir is
+	// loaded unless it is disabled.
+	Enable []string
+	// Disable lists plugins that must not be loaded.
+	Disable []string
+	// Order lists plugins in the order hooks are dispatched to them. If
+	// empty, the plugins.order file in the plugins directory is used.
+	Order []string
+	// Settings holds a section per plugin, keyed by plugin name, which is
+	// delivered to the plugin's Configure hook.
+	Settings map[string]map[string]interface{} `toml:",omitempty"`
+	// MaxFaults is the number of panicking hook invocations after which a
+	// plugin is quarantined. Zero means plugins are never quarantined.
+	MaxFaults uint64
+	// SlowHookThreshold is the execution time above which a warning is
+	// logged for a hook invocation. Zero disables the warning.
+	SlowHookThreshold time.Duration
+	// RemoteTimeout is how long a plugin running in its own process gets to
+	// answer a call. A hook invocation timing out counts as a fault of the
+	// plugin. Zero means the default of 10 seconds.
+	RemoteTimeout time.Duration
+	// Async opts plugins, keyed by name, into asynchronous hook delivery.
+	Async map[string]AsyncConfig `toml:",omitempty"`
+}
+
+// enabled reports whether the plugin identified by any of names should be
+// loaded.
+func (cfg *Config) enabled(names ...string) bool {
+	if cfg.disabled(names...) {
+		return false
+	}
+	return len(cfg.Enable) == 0 || containsAny(cfg.Enable, names)
+}
+
+// disabled reports whether the plugin identified by any of names must not be
+// loaded.
+func (cfg *Config) disabled(names ...string) bool {
+	return containsAny(cfg.Disable, names)
+}
+
+func containsAny(list []string, names []string) bool {
+	for _, item := range list {
+		for _, name := range names {
+			if name != "" && item == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// asyncConfig returns the asynchronous delivery settings of the plugin
+// identified by any of names.
+func (cfg *Config) asyncConfig(names ...string) (AsyncConfig, bool) {
+	for _, name := range names {
+		if async, ok := cfg.Async[name]; ok {
+			return async, true
+		}
+	}
+	return AsyncConfig{}, false
+}
+
+// fileNames returns the names a plugin file can be referred to by.
+func fileNames(file string) []string {
+	return []string{file, strings.TrimSuffix(strings.TrimSuffix(file, ".so"), remoteManifestSuffix)}
 }
 
+// PluginLoader dispatches hooks to the loaded plugins.
+//
+// A PluginLoader is safe for concurrent use: hooks are looked up and invoked
+// concurrently from block import, RPC handlers, the freezer and tracers. The
+// first Lookup of a hook resolves it and caches the result, later lookups of
+// the hook share the cached result. Reloading plugins swaps in a new set of
+// plugins and an empty cache at once, so a Lookup returns the hooks of either
+// the old or the new set of plugins, never a mix. No lock is held while hooks
+// run, and plugins must expect their hooks to be invoked concurrently (unless
+// delivered asynchronously, see AsyncConfig) and may look up hooks from within
+// a hook.
+//
+// Plugins and LookupCache are exported for tests (see HookTester) and must not
+// be modified once the loader is in use.
 type PluginLoader struct {
 	Plugins     []pluginDetails
 	Subcommands map[string]Subcommand
 	Flags       []*flag.FlagSet
 	LookupCache map[string][]interface{}
+	MaxFaults   uint64
+
+	SlowHookThreshold time.Duration
+
+	stats     map[[2]string]*hookTimer // keyed by plugin and hook name
+	statsLock sync.Mutex
+
+	config  Config          // used to load plugins at runtime
+	ctx     *cli.Context    // passed to the Initialize hook of plugins loaded at runtime
+	retired map[string]bool // shared object plugins replaced at runtime, by file
+	allow   map[string]bool // hooks looked up, all if nil (see Restrict)
+
+	lock sync.RWMutex // protects Plugins, LookupCache and retired
+}
+
+// providesLock protects the provides sets of all plugins, which are shared by
+// the loaders returned by Split.
+var providesLock sync.Mutex
+
+// plugins returns the current set of plugins, in dispatch order.
+func (pl *PluginLoader) plugins() []pluginDetails {
+	pl.lock.RLock()
+	defer pl.lock.RUnlock()
+	return pl.Plugins
 }
 
+// Lookup returns the values exported under name by every plugin, in dispatch
+// order, for which validate returns true. The result is cached, so validate
+// must only depend on the type of the value. Functions are returned wrapped,
+// isolating the caller from panics in the plugin (see guard).
 func (pl *PluginLoader) Lookup(name string, validate func(interface{}) bool) []interface{} {
+	return pl.lookup(name, validate, guardedLookup)
+}
+
+// LookupFallible is like Lookup, for hooks returning an error whose callers
+// fall back to geth when they fail. A hook that panics, or belongs to a
+// quarantined plugin, returns an error reporting the fault rather than zero
+// values, which could be mistaken for an answer.
+func (pl *PluginLoader) LookupFallible(name string, validate func(interface{}) bool) []interface{} {
+	return pl.lookup(name, validate, fallibleLookup)
+}
+
+// LookupCritical is like Lookup, for hooks whose results must not be replaced
+// by zero values, such as those affecting consensus. Functions are returned
+// as exported, so a panic in the plugin crashes geth, and the hooks of
+// quarantined plugins are returned as well. A hook must always be looked up
+// by the same method.
+func (pl *PluginLoader) LookupCritical(name string, validate func(interface{}) bool) []interface{} {
+	return pl.lookup(name, validate, criticalLookup)
+}
+
+// lookupMode tells how the hooks of a lookup are isolated from plugins.
+type lookupMode int
+
+const (
+	guardedLookup lookupMode = iota
+	fallibleLookup
+	criticalLookup
+)
+
+func (pl *PluginLoader) lookup(name string, validate func(interface{}) bool, mode lookupMode) []interface{} {
+	guarded := mode != criticalLookup
+	if pl.allow != nil && !pl.allow[name] {
+		return []interface{}{}
+	}
+	pl.lock.RLock()
+	v, ok := pl.LookupCache[name]
+	pl.lock.RUnlock()
+	if ok {
+		return v
+	}
+	pl.lock.Lock()
+	defer pl.lock.Unlock()
 	if v, ok := pl.LookupCache[name]; ok {
 		return v
 	}
+	pl.ensureHealth()
 	results := []interface{}{}
 	for _, plugin := range pl.Plugins {
+		if guarded && plugin.health.isQuarantined() {
+			continue
+		}
 		if v, err := plugin.p.Lookup(name); err == nil {
 			if validate(v) {
+				if guarded {
+					v = pl.guard(plugin, name, v, mode == fallibleLookup)
+					if plugin.queue != nil {
+						v = plugin.queue.wrap(name, v)
+					}
+				}
 				results = append(results, v)
+				if plugin.provides != nil {
+					providesLock.Lock()
+					plugin.provides[name] = struct{}{}
+					providesLock.Unlock()
+				}
+				continue
+			}
+			if plugin.provides != nil {
+				providesLock.Lock()
+				delete(plugin.provides, name)
+				providesLock.Unlock()
+			}
+			if plugin.declares(name) {
+				log.Error("Plugin declares hook but its signature does not match, hook will not be invoked", "plugin", plugin.name, "hook", name, "type", reflect.TypeOf(v), "apiVersion", APIVersion)
 			} else {
 				log.Warn("Plugin matches hook but not signature", "plugin", plugin.name, "hook", name)
 			}
@@ -48,6 +245,25 @@ func (pl *PluginLoader) Lookup(name string, validate func(interface{}) bool) []i
 	return results
 }
 
+// ensureHealth sets up fault accounting for plugins added without it, copying
+// the plugins rather than modifying them in place as they may be in use. The
+// caller must hold pl.lock.
+func (pl *PluginLoader) ensureHealth() {
+	for i := range pl.Plugins {
+		if pl.Plugins[i].health == nil {
+			plugins := make([]pluginDetails, len(pl.Plugins))
+			copy(plugins, pl.Plugins)
+			for j := range plugins {
+				if plugins[j].health == nil {
+					plugins[j].health = &pluginHealth{}
+				}
+			}
+			pl.Plugins = plugins
+			return
+		}
+	}
+}
+
 func Lookup(name string, validate func(interface{}) bool) []interface{} {
 	if DefaultPluginLoader == nil {
 		log.Warn("Lookup attempted, but PluginLoader is not initialized", "name", name)
@@ -56,77 +272,240 @@ func Lookup(name string, validate func(interface{}) bool) []interface{} {
 	return DefaultPluginLoader.Lookup(name, validate)
 }
 
+// declares reports whether the plugin's manifest lists the named hook.
+func (p pluginDetails) declares(hook string) bool {
+	if p.manifest == nil {
+		return false
+	}
+	for _, h := range p.manifest.Hooks {
+		if h == hook {
+			return true
+		}
+	}
+	return false
+}
+
 var DefaultPluginLoader *PluginLoader
 
-func NewPluginLoader(target string) (*PluginLoader, error) {
+func NewPluginLoader(cfg Config) (*PluginLoader, error) {
 	pl := &PluginLoader{
 		Plugins:     []pluginDetails{},
 		Subcommands: make(map[string]Subcommand),
 		Flags:       []*flag.FlagSet{},
 		LookupCache: make(map[string][]interface{}),
+		MaxFaults:   cfg.MaxFaults,
+
+		SlowHookThreshold: cfg.SlowHookThreshold,
+
+		config:  cfg,
+		retired: make(map[string]bool),
 	}
+	target := cfg.Dir
 	files, err := ioutil.ReadDir(target)
 	if err != nil {
 		log.Warn("Could not load plugins directory. Skipping.", "path", target)
 		return pl, nil
 	}
 	for _, file := range files {
-		fpath := path.Join(target, file.Name())
-		if !strings.HasSuffix(file.Name(), ".so") {
-			log.Debug("File inplugin directory is not '.so' file. Skipping.", "file", fpath)
-			continue
+		if plugin, ok := pl.open(&cfg, target, file.Name()); ok {
+			pl.Plugins = append(pl.Plugins, plugin)
 		}
-		plug, err := plugin.Open(fpath)
+	}
+	pl.checkConflicts()
+	pl.sort()
+	return pl, nil
+}
+
+// sort puts the plugins in dispatch order.
+func (pl *PluginLoader) sort() {
+	order := pl.config.Order
+	if len(order) == 0 {
+		order = readOrderFile(pl.config.Dir)
+	}
+	sortPlugins(pl.Plugins, order)
+	for i, plugin := range pl.Plugins {
+		log.Debug("Plugin dispatch order", "position", i, "plugin", plugin.name, "priority", plugin.priority)
+	}
+}
+
+// open loads the plugin file fname in dir, reporting false if it is not a
+// plugin, cannot be loaded or is disabled.
+func (pl *PluginLoader) open(cfg *Config, dir, fname string) (pluginDetails, bool) {
+	fpath := path.Join(dir, fname)
+	var (
+		plug     symbolSource
+		name     = fname
+		manifest *Manifest
+	)
+	// Plugins disabled by file name are skipped without being opened, whether
+	// they are enabled is only known once their manifest is read.
+	if (strings.HasSuffix(fname, ".so") || strings.HasSuffix(fname, remoteManifestSuffix)) && cfg.disabled(fileNames(fname)...) {
+		log.Info("Plugin is disabled. Skipping.", "file", fpath)
+		return pluginDetails{}, false
+	}
+	var rm *remoteManifest
+	switch {
+	case strings.HasSuffix(fname, ".so"):
+		p, err := plugin.Open(fpath)
 		if err != nil {
 			log.Warn("File in plugin directory could not be loaded: %v", "file", fpath, "error", err.Error())
-			continue
+			return pluginDetails{}, false
 		}
-		// Any type of plugin can potentially specify flags
-		f, err := plug.Lookup("Flags")
-		if err == nil {
-			flagset, ok := f.(*flag.FlagSet)
-			if !ok {
-				log.Warn("Found plugin.Flags, but it its not a *FlagSet", "file", fpath)
-			} else {
-				pl.Flags = append(pl.Flags, flagset)
+		plug = p
+		if v, err := p.Lookup("PluginManifest"); err == nil {
+			if manifest, err = decodeManifest(v); err != nil {
+				log.Error("Plugin exports an invalid PluginManifest. Skipping.", "file", fpath, "error", err)
+				return pluginDetails{}, false
 			}
+		} else {
+			log.Warn("Plugin does not export a PluginManifest, compatibility cannot be checked", "file", fpath)
 		}
-		sb, err := plug.Lookup("Subcommands")
-		if err == nil {
-			subcommands, ok := sb.(*map[string]func(*cli.Context, []string) error)
-			if !ok {
-				log.Warn("Could not cast plugin.Subcommands to `map[string]func(*cli.Context, []string) error`", "file", fpath, "type", reflect.TypeOf(sb))
-			} else {
-				for k, v := range *subcommands {
-					if _, ok := pl.Subcommands[k]; ok {
-						log.Warn("Subcommand redeclared", "file", fpath, "subcommand", k)
-					}
-					pl.Subcommands[k] = v
+	case strings.HasSuffix(fname, remoteManifestSuffix):
+		m, err := readRemoteManifest(fpath)
+		if err != nil {
+			log.Warn("Plugin manifest could not be read", "file", fpath, "error", err)
+			return pluginDetails{}, false
+		}
+		rm, manifest = m, &m.Manifest
+	default:
+		log.Debug("File in plugin directory is not '.so' file or plugin manifest. Skipping.", "file", fpath)
+		return pluginDetails{}, false
+	}
+	if manifest != nil && manifest.Name != "" {
+		name = manifest.Name
+	}
+	if !cfg.enabled(append(fileNames(fname), name)...) {
+		log.Info("Plugin is disabled. Skipping.", "plugin", name, "file", fpath)
+		return pluginDetails{}, false
+	}
+	if rm != nil {
+		if rm.APIVersion != "" {
+			if err := checkAPIVersion(rm.APIVersion, APIVersion); err != nil {
+				log.Error("Plugin is incompatible with this version of geth. Skipping.", "file", fpath, "error", err)
+				return pluginDetails{}, false
+			}
+		}
+		rp, err := startRemotePlugin(rm, cfg.RemoteTimeout)
+		if err != nil {
+			log.Warn("Plugin process could not be started", "file", fpath, "exec", rm.Exec, "error", err)
+			return pluginDetails{}, false
+		}
+		log.Info("Started plugin process", "plugin", rm.Name, "exec", rm.Exec)
+		plug = rp
+	}
+	if manifest != nil {
+		if err := checkManifest(plug, manifest, fpath); err != nil {
+			log.Error("Plugin is incompatible with this version of geth. Skipping.", "file", fpath, "error", err)
+			if rp, ok := plug.(*remotePlugin); ok {
+				rp.close()
+			}
+			return pluginDetails{}, false
+		}
+		log.Info("Loaded plugin", "name", name, "version", manifest.Version, "apiVersion", manifest.APIVersion, "hooks", manifest.Hooks)
+	}
+	priority := 0
+	if manifest != nil && manifest.Priority != 0 {
+		priority = manifest.Priority
+	} else if v, err := plug.Lookup("PluginPriority"); err == nil {
+		if p, ok := v.(*int); ok {
+			priority = *p
+		} else {
+			log.Warn("Found plugin.PluginPriority, but it is not an int", "file", fpath, "type", reflect.TypeOf(v))
+		}
+	}
+	// Any type of plugin can potentially specify flags
+	var flagset *flag.FlagSet
+	f, err := plug.Lookup("Flags")
+	if err == nil {
+		var ok bool
+		flagset, ok = f.(*flag.FlagSet)
+		if !ok {
+			log.Warn("Found plugin.Flags, but it its not a *FlagSet", "file", fpath)
+		} else {
+			pl.Flags = append(pl.Flags, flagset)
+		}
+	}
+	sb, err := plug.Lookup("Subcommands")
+	if err == nil {
+		subcommands, ok := sb.(*map[string]func(*cli.Context, []string) error)
+		if !ok {
+			log.Warn("Could not cast plugin.Subcommands to `map[string]func(*cli.Context, []string) error`", "file", fpath, "type", reflect.TypeOf(sb))
+		} else {
+			for k, v := range *subcommands {
+				if _, ok := pl.Subcommands[k]; ok {
+					log.Warn("Subcommand redeclared", "file", fpath, "subcommand", k)
 				}
+				pl.Subcommands[k] = v
 			}
 		}
-		pl.Plugins = append(pl.Plugins, pluginDetails{plug, fpath})
 	}
-	return pl, nil
+	var queue *hookQueue
+	if async, ok := cfg.asyncConfig(append(fileNames(fname), name)...); ok {
+		if queue, err = newHookQueue(name, async); err != nil {
+			log.Error("Invalid asynchronous delivery settings, hooks will be invoked synchronously", "plugin", name, "error", err)
+		}
+	}
+	return pluginDetails{
+		p:        plug,
+		name:     name,
+		file:     fpath,
+		manifest: manifest,
+		priority: priority,
+		flags:    flagset,
+		provides: exportedHooks(plug),
+		health:   &pluginHealth{},
+		queue:    queue,
+	}, true
 }
 
-func Initialize(target string, ctx *cli.Context) (err error) {
-	DefaultPluginLoader, err = NewPluginLoader(target)
+func Initialize(cfg Config, ctx *cli.Context) (err error) {
+	DefaultPluginLoader, err = NewPluginLoader(cfg)
 	if err != nil {
 		return err
 	}
+	if err := DefaultPluginLoader.Configure(cfg.Settings); err != nil {
+		return err
+	}
 	DefaultPluginLoader.Initialize(ctx)
 	return nil
 }
 
 func (pl *PluginLoader) Initialize(ctx *cli.Context) {
+	pl.ctx = ctx
+	pl.initialize(ctx, pl)
+}
+
+// initialize invokes the Initialize hook of the plugins of pl, handing them
+// loader for looking up the hooks of other plugins.
+func (pl *PluginLoader) initialize(ctx *cli.Context, loader core.PluginLoader) {
 	fns := pl.Lookup("Initialize", func(i interface{}) bool {
 		_, ok := i.(func(*cli.Context, core.PluginLoader, core.Logger))
 		return ok
 	})
 	for _, fni := range fns {
 		if fn, ok := fni.(func(*cli.Context, core.PluginLoader, core.Logger)); ok {
-			fn(ctx, pl, log.Root())
+			fn(ctx, loader, log.Root())
+		}
+	}
+}
+
+// Drain stops asynchronous hook delivery, waiting for queued hook invocations
+// to complete. Hooks invoked afterwards are discarded.
+func (pl *PluginLoader) Drain() {
+	for _, plugin := range pl.plugins() {
+		if plugin.queue != nil {
+			plugin.queue.close()
+		}
+	}
+}
+
+// Close drains asynchronous hook queues and stops any plugins running in their
+// own process.
+func (pl *PluginLoader) Close() {
+	pl.Drain()
+	for _, plugin := range pl.plugins() {
+		if rp, ok := plugin.p.(*remotePlugin); ok {
+			rp.close()
 		}
 	}
 }
@@ -150,13 +529,6 @@ func RunSubcommand(ctx *cli.Context) (bool, error) {
 	return DefaultPluginLoader.RunSubcommand(ctx)
 }
 
-func (pl *PluginLoader) ParseFlags(args []string) bool {
-	for _, flagset := range pl.Flags {
-		flagset.Parse(args)
-	}
-	return len(pl.Flags) > 0
-}
-
 func ParseFlags(args []string) bool {
 	if DefaultPluginLoader == nil {
 		log.Warn("Attempting to parse flags, but default PluginLoader has not been initialized")
@@ -0,0 +1,210 @@
+package plugins
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Plugins can be loaded while the node is running. Shared object plugins
+// cannot be unloaded, so they are reloaded by version: a new file providing a
+// plugin of the same name replaces the loaded plugin, which stays in memory
+// but is no longer dispatched to. As Go refuses to open two plugins built from
+// the same package, each version must be built with a distinct plugin path
+// (go build -buildmode=plugin -ldflags=-pluginpath=<name>-<version>). Plugins
+// running in their own process are restarted, and stopped if their manifest
+// is removed.
+//
+// Load and Reload return loaders holding the plugins that were added and
+// removed, so the caller can invoke lifecycle hooks (such as InitializeNode,
+// GetAPIs and OnShutdown) on the affected plugins only. The caller must Close
+// the loader of removed plugins.
+
+// Load loads the plugin file fpath, which is relative to the plugins directory
+// unless absolute, replacing any loaded plugin of the same name.
+func (pl *PluginLoader) Load(fpath string) (added, removed *PluginLoader, err error) {
+	if !filepath.IsAbs(fpath) {
+		fpath = filepath.Join(pl.config.Dir, fpath)
+	}
+	if pl.isRetired(fpath) {
+		return nil, nil, fmt.Errorf("plugin %v was replaced and cannot be loaded again", fpath)
+	}
+	if _, err := os.Stat(fpath); err != nil {
+		return nil, nil, err
+	}
+	for _, plugin := range pl.plugins() {
+		if _, ok := plugin.p.(*remotePlugin); !ok && plugin.file == fpath {
+			return nil, nil, fmt.Errorf("plugin %v is already loaded", fpath)
+		}
+	}
+	plugin, ok := pl.open(&pl.config, filepath.Dir(fpath), filepath.Base(fpath))
+	if !ok {
+		return nil, nil, fmt.Errorf("plugin %v could not be loaded", fpath)
+	}
+	if err := plugin.configure(pl.config.Settings); err != nil {
+		pl.subset([]pluginDetails{plugin}).Close()
+		return nil, nil, err
+	}
+	added, removed = pl.replace([]pluginDetails{plugin}, nil)
+	return added, removed, nil
+}
+
+// Reload restarts the plugins running in their own process, and loads plugin
+// files added to the plugins directory since the plugins were last loaded.
+func (pl *PluginLoader) Reload() (added, removed *PluginLoader, err error) {
+	files, err := ioutil.ReadDir(pl.config.Dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		plugins []pluginDetails
+		present = make(map[string]bool)
+		loaded  = make(map[string]bool)
+	)
+	for _, plugin := range pl.plugins() {
+		if _, ok := plugin.p.(*remotePlugin); !ok {
+			loaded[plugin.file] = true
+		}
+	}
+	for _, file := range files {
+		fpath := path.Join(pl.config.Dir, file.Name())
+		present[fpath] = true
+		if loaded[fpath] || pl.isRetired(fpath) {
+			continue
+		}
+		plugin, ok := pl.open(&pl.config, pl.config.Dir, file.Name())
+		if !ok {
+			continue
+		}
+		if err := plugin.configure(pl.config.Settings); err != nil {
+			log.Error("Plugin could not be reloaded", "file", fpath, "error", err)
+			pl.subset([]pluginDetails{plugin}).Close()
+			continue
+		}
+		plugins = append(plugins, plugin)
+	}
+	var unload []pluginDetails
+	for _, plugin := range pl.plugins() {
+		if _, ok := plugin.p.(*remotePlugin); ok && !present[plugin.file] {
+			unload = append(unload, plugin)
+		}
+	}
+	added, removed = pl.replace(plugins, unload)
+	return added, removed, nil
+}
+
+// replace adds plugins to the loader, removing loaded plugins of the same name
+// or file as well as the plugins in unload, and invokes the Initialize hook of
+// the added plugins.
+func (pl *PluginLoader) replace(plugins, unload []pluginDetails) (added, removed *PluginLoader) {
+	pl.lock.Lock()
+	if pl.retired == nil {
+		pl.retired = make(map[string]bool)
+	}
+	var kept []pluginDetails
+	for _, old := range pl.Plugins {
+		replaced := false
+		for _, plugin := range plugins {
+			if old.prefix() == plugin.prefix() || old.file == plugin.file {
+				replaced = true
+			}
+		}
+		for _, plugin := range unload {
+			if old.file == plugin.file {
+				replaced = true
+			}
+		}
+		if !replaced {
+			kept = append(kept, old)
+			continue
+		}
+		if _, ok := old.p.(*remotePlugin); !ok {
+			pl.retired[old.file] = true
+		}
+		unload = append(unload, old)
+		log.Info("Unloading plugin", "name", old.name, "file", old.file)
+	}
+	removed = pl.subset(dedupPlugins(unload))
+	added = pl.subset(plugins)
+	for _, plugin := range plugins {
+		log.Info("Loading plugin", "name", plugin.name, "file", plugin.file)
+	}
+	kept = append(kept, plugins...)
+	sorted := &PluginLoader{Plugins: kept, config: pl.config}
+	sorted.checkConflicts()
+	sorted.sort()
+	pl.Plugins = sorted.Plugins
+	pl.LookupCache = make(map[string][]interface{})
+	pl.lock.Unlock()
+
+	added.initialize(pl.ctx, pl)
+	return added, removed
+}
+
+// subset returns a loader dispatching to plugins only, with the settings of pl.
+func (pl *PluginLoader) subset(plugins []pluginDetails) *PluginLoader {
+	return &PluginLoader{
+		Plugins:     plugins,
+		Subcommands: make(map[string]Subcommand),
+		Flags:       []*flag.FlagSet{},
+		LookupCache: make(map[string][]interface{}),
+		MaxFaults:   pl.MaxFaults,
+
+		SlowHookThreshold: pl.SlowHookThreshold,
+
+		config:  pl.config,
+		ctx:     pl.ctx,
+		retired: make(map[string]bool),
+	}
+}
+
+// Split returns a loader for each plugin, in dispatch order, for invoking
+// hooks on plugins individually.
+func (pl *PluginLoader) Split() []*PluginLoader {
+	plugins := pl.plugins()
+	result := make([]*PluginLoader, len(plugins))
+	for i, plugin := range plugins {
+		result[i] = pl.subset([]pluginDetails{plugin})
+	}
+	return result
+}
+
+// Restrict returns a loader for the plugins of pl that only looks up the given
+// hooks, and delivers them synchronously regardless of the asynchronous
+// delivery configuration of the plugins. It is used to replay hooks.
+func (pl *PluginLoader) Restrict(hooks ...string) *PluginLoader {
+	plugins := append([]pluginDetails{}, pl.plugins()...)
+	for i := range plugins {
+		plugins[i].queue = nil
+	}
+	restricted := pl.subset(plugins)
+	restricted.allow = make(map[string]bool)
+	for _, hook := range hooks {
+		restricted.allow[hook] = true
+	}
+	return restricted
+}
+
+// isRetired reports whether the shared object plugin file was replaced.
+func (pl *PluginLoader) isRetired(file string) bool {
+	pl.lock.RLock()
+	defer pl.lock.RUnlock()
+	return pl.retired[file]
+}
+
+func dedupPlugins(plugins []pluginDetails) []pluginDetails {
+	seen := make(map[string]bool)
+	result := make([]pluginDetails, 0, len(plugins))
+	for _, plugin := range plugins {
+		if !seen[plugin.file] {
+			seen[plugin.file] = true
+			result = append(result, plugin)
+		}
+	}
+	return result
+}
@@ -0,0 +1,105 @@
+package plugins
+
+import (
+	"testing"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/urfave/cli/v2"
+)
+
+func TestReplacePlugins(t *testing.T) {
+	var initialized core.PluginLoader
+	pl := &PluginLoader{
+		Plugins: []pluginDetails{
+			{p: testPlugin{"Hook": func() int { return 1 }}, name: "a", file: "/plugins/a-v1.so", manifest: &Manifest{Name: "a"}},
+			{p: testPlugin{"Hook": func() int { return 2 }}, name: "b", file: "/plugins/b.so"},
+		},
+		LookupCache: make(map[string][]interface{}),
+	}
+	hooks := func(pl *PluginLoader) (result []int) {
+		for _, fni := range pl.Lookup("Hook", func(item interface{}) bool {
+			_, ok := item.(func() int)
+			return ok
+		}) {
+			result = append(result, fni.(func() int)())
+		}
+		return result
+	}
+	if got := hooks(pl); len(got) != 2 {
+		t.Fatalf("Expected two hooks, got %v", got)
+	}
+	v2 := pluginDetails{
+		p: testPlugin{
+			"Hook": func() int { return 3 },
+			"Initialize": func(ctx *cli.Context, loader core.PluginLoader, logger core.Logger) {
+				initialized = loader
+			},
+		},
+		name:     "a",
+		file:     "/plugins/a-v2.so",
+		manifest: &Manifest{Name: "a"},
+	}
+	added, removed := pl.replace([]pluginDetails{v2}, nil)
+	if len(added.Plugins) != 1 || added.Plugins[0].file != v2.file {
+		t.Errorf("Unexpected added plugins %v", added.PluginInfo())
+	}
+	if len(removed.Plugins) != 1 || removed.Plugins[0].file != "/plugins/a-v1.so" {
+		t.Errorf("Unexpected removed plugins %v", removed.PluginInfo())
+	}
+	if initialized != pl {
+		t.Errorf("Expected added plugin to be initialized with the loader")
+	}
+	if got := hooks(pl); len(got) != 2 || got[0] != 3 || got[1] != 2 {
+		t.Errorf("Expected hooks of the new version to be dispatched, got %v", got)
+	}
+	if got := hooks(removed); len(got) != 1 || got[0] != 1 {
+		t.Errorf("Expected removed loader to dispatch to the old version, got %v", got)
+	}
+	if _, _, err := pl.Load("/plugins/a-v1.so"); err == nil {
+		t.Errorf("Expected replaced plugin not to be loaded again")
+	}
+	if split := pl.Split(); len(split) != 2 || len(split[0].Plugins) != 1 {
+		t.Errorf("Expected a loader per plugin")
+	}
+}
+
+func TestRestrict(t *testing.T) {
+	var heads []int
+	queue, err := newHookQueue("async", AsyncConfig{Hooks: []string{"NewHead"}, QueueSize: 1, Policy: PolicyBlock})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	pl := &PluginLoader{
+		Plugins: []pluginDetails{{
+			p: testPlugin{
+				"NewHead": func(n int) { heads = append(heads, n) },
+				"Other":   func(n int) { t.Errorf("Unexpected invocation of hook not replayed") },
+			},
+			name:  "async",
+			file:  "async.so",
+			queue: queue,
+		}},
+		LookupCache: make(map[string][]interface{}),
+	}
+	restricted := pl.Restrict("NewHead")
+	validate := func(item interface{}) bool {
+		_, ok := item.(func(int))
+		return ok
+	}
+	if fns := restricted.Lookup("Other", validate); len(fns) != 0 {
+		t.Errorf("Expected hooks not replayed to be hidden, got %d", len(fns))
+	}
+	fns := restricted.Lookup("NewHead", validate)
+	if len(fns) != 1 {
+		t.Fatalf("Expected one hook, got %d", len(fns))
+	}
+	fns[0].(func(int))(1)
+	// Delivery is synchronous, the hook ran without draining the queue.
+	if len(heads) != 1 || heads[0] != 1 {
+		t.Errorf("Unexpected delivered heads %v", heads)
+	}
+	if len(pl.Lookup("Other", validate)) != 1 {
+		t.Errorf("Expected the original loader to be unrestricted")
+	}
+	pl.Drain()
+}
@@ -0,0 +1,276 @@
+package remote
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	errorType       = reflect.TypeOf((*error)(nil)).Elem()
+	marshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// Encode converts a hook argument or result into its wire representation.
+// Byte slices and byte arrays are hex encoded with a 0x prefix, maps are
+// always keyed by strings, structs are objects keyed by the JSON names of
+// their fields (unless they implement json.Marshaler), and errors are sent as
+// their message (or null).
+func Encode(v reflect.Value) (json.RawMessage, error) {
+	return json.Marshal(toWire(v))
+}
+
+// Decode converts a wire value back into a value of type t. It is the inverse
+// of Encode.
+func Decode(data json.RawMessage, t reflect.Type) (reflect.Value, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return reflect.Zero(t), nil
+	}
+	if t == errorType {
+		var msg string
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(errors.New(msg)), nil
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		if t.Implements(unmarshalerType) {
+			break
+		}
+		v, err := Decode(data, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		ptr := reflect.New(t.Elem())
+		ptr.Elem().Set(v)
+		return ptr, nil
+	case reflect.Struct:
+		if reflect.PtrTo(t).Implements(unmarshalerType) {
+			break
+		}
+		items := make(map[string]json.RawMessage)
+		if err := json.Unmarshal(data, &items); err != nil {
+			return reflect.Value{}, err
+		}
+		out := reflect.New(t).Elem()
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := fieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			v, err := Decode(items[name], t.Field(i).Type)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			out.Field(i).Set(v)
+		}
+		return out, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			b, err := decodeBytes(data)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			return reflect.ValueOf(b).Convert(t), nil
+		}
+		items := []json.RawMessage{}
+		if err := json.Unmarshal(data, &items); err != nil {
+			return reflect.Value{}, err
+		}
+		out := reflect.MakeSlice(t, len(items), len(items))
+		for i, item := range items {
+			v, err := Decode(item, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			out.Index(i).Set(v)
+		}
+		return out, nil
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			b, err := decodeBytes(data)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			return bytesToArray(b, t)
+		}
+	case reflect.Map:
+		items := make(map[string]json.RawMessage)
+		if err := json.Unmarshal(data, &items); err != nil {
+			return reflect.Value{}, err
+		}
+		out := reflect.MakeMapWithSize(t, len(items))
+		for k, item := range items {
+			key, err := decodeKey(k, t.Key())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v, err := Decode(item, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			out.SetMapIndex(key, v)
+		}
+		return out, nil
+	}
+	ptr := reflect.New(t)
+	if err := json.Unmarshal(data, ptr.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return ptr.Elem(), nil
+}
+
+func toWire(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		if !v.Type().Implements(marshalerType) {
+			return toWire(v.Elem())
+		}
+	case reflect.Struct:
+		if v.Type().Implements(marshalerType) {
+			break
+		}
+		out := make(map[string]interface{}, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			if name, ok := fieldName(v.Type().Field(i)); ok {
+				out[name] = toWire(v.Field(i))
+			}
+		}
+		return out
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if err, ok := v.Interface().(error); ok {
+			return err.Error()
+		}
+		return toWire(v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return "0x" + hex.EncodeToString(v.Bytes())
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = toWire(v.Index(i))
+		}
+		return out
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return "0x" + hex.EncodeToString(arrayToBytes(v))
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		out := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			out[encodeKey(iter.Key())] = toWire(iter.Value())
+		}
+		return out
+	}
+	return v.Interface()
+}
+
+// fieldName returns the name of a struct field on the wire, its JSON name, and
+// whether it is sent at all.
+func fieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	name := f.Name
+	if tag := f.Tag.Get("json"); tag != "" {
+		if tag = strings.Split(tag, ",")[0]; tag == "-" {
+			return "", false
+		} else if tag != "" {
+			name = tag
+		}
+	}
+	return name, true
+}
+
+func encodeKey(k reflect.Value) string {
+	switch k.Kind() {
+	case reflect.String:
+		return k.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(k.Uint(), 10)
+	case reflect.Array:
+		if k.Type().Elem().Kind() == reflect.Uint8 {
+			return "0x" + hex.EncodeToString(arrayToBytes(k))
+		}
+	}
+	return fmt.Sprint(k.Interface())
+}
+
+func decodeKey(s string, t reflect.Type) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetUint(n)
+	case reflect.Array:
+		if t.Elem().Kind() != reflect.Uint8 {
+			return reflect.Value{}, fmt.Errorf("unsupported map key type %v", t)
+		}
+		b, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return bytesToArray(b, t)
+	default:
+		return reflect.Value{}, fmt.Errorf("unsupported map key type %v", t)
+	}
+	return v, nil
+}
+
+func decodeBytes(data json.RawMessage) ([]byte, error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
+
+func arrayToBytes(v reflect.Value) []byte {
+	b := make([]byte, v.Len())
+	reflect.Copy(reflect.ValueOf(b), v)
+	return b
+}
+
+func bytesToArray(b []byte, t reflect.Type) (reflect.Value, error) {
+	if len(b) != t.Len() {
+		return reflect.Value{}, fmt.Errorf("expected %d bytes for %v, got %d", t.Len(), t, len(b))
+	}
+	v := reflect.New(t).Elem()
+	reflect.Copy(v, reflect.ValueOf(b))
+	return v, nil
+}
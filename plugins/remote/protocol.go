@@ -0,0 +1,170 @@
+// Package remote implements the wire protocol spoken between PluGeth and
+// plugins that run as separate executables.
+//
+// An out-of-process plugin is declared by a `<name>.plugin.json` manifest in
+// the plugins directory. Geth launches the executable named in the manifest
+// with the path of a unix socket in the PLUGETH_PLUGIN_SOCKET environment
+// variable; the plugin connects to that socket and serves the "Plugin"
+// service using JSON-RPC (as implemented by net/rpc/jsonrpc). Plugins written
+// in Go can use Serve or Main from this package, while plugins written in
+// other languages only need to implement the handful of methods below.
+//
+// Hook arguments and results are JSON encoded as described in Encode, so the
+// protocol is independent of the toolchain and module versions geth was
+// built with.
+package remote
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"time"
+
+	"github.com/ethereum/go-ethereum/plugins/freezer"
+	"github.com/ethereum/go-ethereum/plugins/statediff"
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+const (
+	// SocketEnv is the environment variable holding the socket path a plugin
+	// process should connect to.
+	SocketEnv = "PLUGETH_PLUGIN_SOCKET"
+	// ServiceName is the name of the net/rpc service plugins must serve.
+	ServiceName = "Plugin"
+)
+
+// HookTypes lists the hooks that can be served out of process, along with the
+// signature the plugin loader expects for each of them. Hooks that receive
+// live node objects (such as InitializeNode or GetLiveTracer) cannot cross a
+// process boundary and are not listed. GetAPIs and Tracers are handled
+// separately, see API and TraceArgs.
+var HookTypes = map[string]reflect.Type{
+	"PreProcessBlock":        reflect.TypeOf(func(core.Hash, uint64, []byte) {}),
+	"PreProcessTransaction":  reflect.TypeOf(func([]byte, core.Hash, core.Hash, int) {}),
+	"BlockProcessingError":   reflect.TypeOf(func(core.Hash, core.Hash, error) {}),
+	"PostProcessTransaction": reflect.TypeOf(func(core.Hash, core.Hash, int, []byte) {}),
+	"PostProcessBlock":       reflect.TypeOf(func(core.Hash) {}),
+	"NewHead":                reflect.TypeOf(func([]byte, core.Hash, [][]byte, *big.Int) {}),
+	"NewSideBlock":           reflect.TypeOf(func([]byte, core.Hash, [][]byte) {}),
+	"Reorg":                  reflect.TypeOf(func(core.Hash, []core.Hash, []core.Hash) {}),
+	"StateUpdate": reflect.TypeOf(func(core.Hash, core.Hash, map[core.Hash]struct{}, map[core.Hash][]byte, map[core.Hash]map[core.Hash][]byte, map[core.Hash][]byte) {
+	}),
+	"StateDiff":           reflect.TypeOf(func(core.Hash, core.Hash, map[core.Address]*statediff.AccountDiff) {}),
+	"GetRPCCalls":         reflect.TypeOf(func(string, string, string) {}),
+	"ModifyAncients":      reflect.TypeOf(func(uint64, map[string]interface{}) {}),
+	"FreezerBatch":        reflect.TypeOf(func([]*freezer.Block) {}),
+	"FreezerTruncateHead": reflect.TypeOf(func(uint64) {}),
+	"FreezerTruncateTail": reflect.TypeOf(func(uint64) {}),
+	"OnShutdown":          reflect.TypeOf(func() {}),
+	"Configure":           reflect.TypeOf(func(map[string]interface{}) error { return nil }),
+
+	"ValidatePoolTransaction":    reflect.TypeOf(func([]byte, bool) error { return nil }),
+	"PoolTransactionAdded":       reflect.TypeOf(func([]byte, bool) {}),
+	"PoolTransactionDropped":     reflect.TypeOf(func(core.Hash, string) {}),
+	"PoolTransactionReplaced":    reflect.TypeOf(func(core.Hash, core.Hash) {}),
+	"OrderTransactions":          reflect.TypeOf(func(map[core.Address][][]byte, map[core.Address][][]byte, *big.Int, uint64) [][][]byte { return nil }),
+	"PayloadFeeRecipient":        reflect.TypeOf(func(core.Hash, uint64, core.Hash, core.Address) core.Address { return core.Address{} }),
+	"PayloadTransactions":        reflect.TypeOf(func(core.Hash, uint64, uint64, core.Address) [][]byte { return nil }),
+	"PayloadBuilt":               reflect.TypeOf(func(core.Hash, []byte, *big.Int) {}),
+	"PeerConnected":              reflect.TypeOf(func(string, string, []byte, []string, bool) {}),
+	"PeerDisconnected":           reflect.TypeOf(func(string, string, bool, string, time.Duration) {}),
+	"NewPooledTransactionHashes": reflect.TypeOf(func(string, []core.Hash) {}),
+	"NewBlockHashes":             reflect.TypeOf(func(string, []core.Hash, []uint64) {}),
+	"NewBlock":                   reflect.TypeOf(func(string, core.Hash, uint64, *big.Int) {}),
+	"PeerFilter":                 reflect.TypeOf(func(string, []byte, bool) bool { return false }),
+	"TrustedPeers":               reflect.TypeOf(func() []string { return nil }),
+	"SyncStarted":                reflect.TypeOf(func(string, uint64, uint64) {}),
+	"SyncPivot":                  reflect.TypeOf(func(uint64, core.Hash, core.Hash) {}),
+	"SnapSyncPhase":              reflect.TypeOf(func(string, core.Hash) {}),
+	"SyncCompleted":              reflect.TypeOf(func(string, error) {}),
+	"RPCCallRequest": reflect.TypeOf(func(string, string, string, json.RawMessage) (json.RawMessage, json.RawMessage, error) {
+		return nil, nil, nil
+	}),
+	"RPCCallResponse":    reflect.TypeOf(func(string, string, string, json.RawMessage) json.RawMessage { return nil }),
+	"RPCCallComplete":    reflect.TypeOf(func(string, string, time.Duration, json.RawMessage, error) {}),
+	"RPCBatchComplete":   reflect.TypeOf(func([]string, time.Duration) {}),
+	"GetSnapshotAccount": reflect.TypeOf(func(core.Hash, core.Hash) ([]byte, error) { return nil, nil }),
+	"GetSnapshotStorage": reflect.TypeOf(func(core.Hash, core.Hash, core.Hash) ([]byte, error) { return nil, nil }),
+}
+
+// HooksArgs is the request for Plugin.Hooks.
+type HooksArgs struct{}
+
+// HooksReply describes everything a plugin process provides.
+type HooksReply struct {
+	Hooks   []string `json:"hooks"`
+	APIs    []API    `json:"apis"`
+	Tracers []string `json:"tracers"`
+}
+
+// API describes an RPC namespace served by a plugin process. Methods maps
+// each method name to the number of parameters it takes.
+type API struct {
+	Namespace string         `json:"namespace"`
+	Version   string         `json:"version"`
+	Public    bool           `json:"public"`
+	Methods   map[string]int `json:"methods"`
+}
+
+// CallArgs is the request for Plugin.Call, which invokes a hook.
+type CallArgs struct {
+	Hook string            `json:"hook"`
+	Args []json.RawMessage `json:"args"`
+}
+
+// CallReply carries the values returned by a hook.
+type CallReply struct {
+	Results []json.RawMessage `json:"results"`
+}
+
+// APICallArgs is the request for Plugin.CallAPI, which invokes an RPC method
+// exposed by the plugin.
+type APICallArgs struct {
+	Namespace string            `json:"namespace"`
+	Method    string            `json:"method"`
+	Args      []json.RawMessage `json:"args"`
+}
+
+// APICallReply carries the result of an RPC method.
+type APICallReply struct {
+	Result json.RawMessage `json:"result"`
+}
+
+// TraceArgs is the request for Plugin.Trace. Since tracer callbacks fire for
+// every opcode, the loader records them locally and ships the whole sequence
+// once the tracer result is requested.
+type TraceArgs struct {
+	Tracer  string            `json:"tracer"`
+	Context core.BlockContext `json:"context"`
+	Events  []TraceEvent      `json:"events"`
+}
+
+// TraceReply carries the result of a tracer.
+type TraceReply struct {
+	Result json.RawMessage `json:"result"`
+}
+
+// TraceEvent is a single recorded tracer callback. Kind is one of "start",
+// "state", "fault", "end", "enter" and "exit", and only the fields relevant
+// to that callback are set. Stack holds the stack items bottom first, as
+// 0x-prefixed hex strings.
+type TraceEvent struct {
+	Kind     string        `json:"kind"`
+	From     core.Address  `json:"from,omitempty"`
+	To       core.Address  `json:"to,omitempty"`
+	Create   bool          `json:"create,omitempty"`
+	Input    []byte        `json:"input,omitempty"`
+	Gas      uint64        `json:"gas,omitempty"`
+	Value    *big.Int      `json:"value,omitempty"`
+	PC       uint64        `json:"pc,omitempty"`
+	Op       core.OpCode   `json:"op,omitempty"`
+	Cost     uint64        `json:"cost,omitempty"`
+	Depth    int           `json:"depth,omitempty"`
+	Stack    []string      `json:"stack,omitempty"`
+	Contract core.Address  `json:"contract,omitempty"`
+	Caller   core.Address  `json:"caller,omitempty"`
+	Output   []byte        `json:"output,omitempty"`
+	GasUsed  uint64        `json:"gasUsed,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
@@ -0,0 +1,295 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"unicode"
+
+	"github.com/holiman/uint256"
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// Plugin describes what a plugin process provides to geth.
+type Plugin struct {
+	// Hooks maps hook names to functions. Each function must match the
+	// signature listed for that hook in HookTypes.
+	Hooks map[string]interface{}
+	// APIs are exposed on geth's RPC server. Every exported method of a
+	// service becomes an RPC method; subscriptions are not supported.
+	APIs []core.API
+	// Tracers are made available to debug_trace* calls by name.
+	Tracers map[string]func(core.StateDB, core.BlockContext) core.TracerResult
+}
+
+// Main connects to the socket geth provided through SocketEnv and serves p
+// until geth closes the connection.
+func Main(p *Plugin) {
+	conn, err := net.Dial("unix", os.Getenv(SocketEnv))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not connect to geth: %v\n", err)
+		os.Exit(1)
+	}
+	if err := Serve(conn, p); err != nil {
+		fmt.Fprintf(os.Stderr, "could not serve plugin: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// Serve serves p over conn, blocking until the connection is closed.
+func Serve(conn io.ReadWriteCloser, p *Plugin) error {
+	svc := &service{
+		plugin: p,
+		hooks:  make(map[string]reflect.Value),
+		apis:   make(map[string]map[string]reflect.Value),
+	}
+	for name, hook := range p.Hooks {
+		t, ok := HookTypes[name]
+		if !ok {
+			return fmt.Errorf("hook %v cannot be served out of process", name)
+		}
+		if reflect.TypeOf(hook) != t {
+			return fmt.Errorf("hook %v has type %T, expected %v", name, hook, t)
+		}
+		svc.hooks[name] = reflect.ValueOf(hook)
+	}
+	for _, api := range p.APIs {
+		methods, ok := svc.apis[api.Namespace]
+		if !ok {
+			methods = make(map[string]reflect.Value)
+			svc.apis[api.Namespace] = methods
+		}
+		rcvr := reflect.ValueOf(api.Service)
+		for i := 0; i < rcvr.NumMethod(); i++ {
+			if m := rcvr.Type().Method(i); m.PkgPath == "" {
+				methods[formatName(m.Name)] = rcvr.Method(i)
+			}
+		}
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName(ServiceName, svc); err != nil {
+		return err
+	}
+	server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	return nil
+}
+
+type service struct {
+	plugin *Plugin
+	hooks  map[string]reflect.Value
+	apis   map[string]map[string]reflect.Value
+}
+
+func (s *service) Hooks(_ HooksArgs, reply *HooksReply) error {
+	for name := range s.hooks {
+		reply.Hooks = append(reply.Hooks, name)
+	}
+	sort.Strings(reply.Hooks)
+	for _, api := range s.plugin.APIs {
+		desc := API{Namespace: api.Namespace, Version: api.Version, Public: api.Public, Methods: make(map[string]int)}
+		for name, m := range s.apis[api.Namespace] {
+			n := m.Type().NumIn()
+			if n > 0 && m.Type().In(0) == contextType {
+				n--
+			}
+			desc.Methods[name] = n
+		}
+		reply.APIs = append(reply.APIs, desc)
+	}
+	for name := range s.plugin.Tracers {
+		reply.Tracers = append(reply.Tracers, name)
+	}
+	sort.Strings(reply.Tracers)
+	return nil
+}
+
+func (s *service) Call(args CallArgs, reply *CallReply) error {
+	fn, ok := s.hooks[args.Hook]
+	if !ok {
+		return fmt.Errorf("hook %v not provided", args.Hook)
+	}
+	out, err := invoke(fn, nil, args.Args)
+	if err != nil {
+		return err
+	}
+	for _, v := range out {
+		data, err := Encode(v)
+		if err != nil {
+			return err
+		}
+		reply.Results = append(reply.Results, data)
+	}
+	return nil
+}
+
+func (s *service) CallAPI(args APICallArgs, reply *APICallReply) error {
+	fn, ok := s.apis[args.Namespace][args.Method]
+	if !ok {
+		return fmt.Errorf("method %v_%v not provided", args.Namespace, args.Method)
+	}
+	out, err := invoke(fn, context.Background(), args.Args)
+	if err != nil {
+		return err
+	}
+	if len(out) > 0 {
+		if err, ok := out[len(out)-1].Interface().(error); ok && err != nil {
+			return err
+		}
+		if out[0].Type() != errorType {
+			reply.Result, err = json.Marshal(out[0].Interface())
+		}
+	}
+	return err
+}
+
+func (s *service) Trace(args TraceArgs, reply *TraceReply) (err error) {
+	fn, ok := s.plugin.Tracers[args.Tracer]
+	if !ok {
+		return fmt.Errorf("tracer %v not provided", args.Tracer)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("tracer %v panicked: %v\n%s", args.Tracer, r, debug.Stack())
+		}
+	}()
+	tracer := fn(noState{}, args.Context)
+	for _, ev := range args.Events {
+		var evErr error
+		if ev.Error != "" {
+			evErr = fmt.Errorf("%v", ev.Error)
+		}
+		switch ev.Kind {
+		case "start":
+			tracer.CaptureStart(ev.From, ev.To, ev.Create, ev.Input, ev.Gas, ev.Value)
+		case "state":
+			tracer.CaptureState(ev.PC, ev.Op, ev.Gas, ev.Cost, newScope(ev), nil, ev.Depth, evErr)
+		case "fault":
+			tracer.CaptureFault(ev.PC, ev.Op, ev.Gas, ev.Cost, newScope(ev), ev.Depth, evErr)
+		case "end":
+			tracer.CaptureEnd(ev.Output, ev.GasUsed, ev.Duration, evErr)
+		case "enter":
+			tracer.CaptureEnter(ev.Op, ev.From, ev.To, ev.Input, ev.Gas, ev.Value)
+		case "exit":
+			tracer.CaptureExit(ev.Output, ev.GasUsed, evErr)
+		}
+	}
+	result, err := tracer.Result()
+	if err != nil {
+		return err
+	}
+	reply.Result, err = json.Marshal(result)
+	return err
+}
+
+// invoke decodes args into the parameters of fn and calls it, converting
+// panics into errors so that a faulty hook does not take the process down.
+func invoke(fn reflect.Value, ctx context.Context, args []json.RawMessage) (out []reflect.Value, err error) {
+	t := fn.Type()
+	in := []reflect.Value{}
+	if ctx != nil && t.NumIn() > 0 && t.In(0) == contextType {
+		in = append(in, reflect.ValueOf(ctx))
+	}
+	if len(in)+len(args) != t.NumIn() {
+		return nil, fmt.Errorf("expected %d arguments, got %d", t.NumIn()-len(in), len(args))
+	}
+	for _, arg := range args {
+		v, err := Decode(arg, t.In(len(in)))
+		if err != nil {
+			return nil, err
+		}
+		in = append(in, v)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("plugin panicked: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return fn.Call(in), nil
+}
+
+// formatName converts the first character of name to lowercase, matching
+// the method names geth's RPC server exposes.
+func formatName(name string) string {
+	ret := []rune(name)
+	if len(ret) > 0 {
+		ret[0] = unicode.ToLower(ret[0])
+	}
+	return string(ret)
+}
+
+// scope is a snapshot of the EVM scope recorded alongside a tracer event.
+// Memory is not recorded, as copying it on every opcode is too expensive.
+type scope struct {
+	stack    stack
+	contract *contract
+}
+
+func newScope(ev TraceEvent) *scope {
+	s := &scope{contract: &contract{address: ev.Contract, caller: ev.Caller}}
+	for _, item := range ev.Stack {
+		v, err := uint256.FromHex(item)
+		if err != nil {
+			v = new(uint256.Int)
+		}
+		s.stack = append(s.stack, v)
+	}
+	return s
+}
+
+func (s *scope) Memory() core.Memory     { return memory{} }
+func (s *scope) Stack() core.Stack       { return s.stack }
+func (s *scope) Contract() core.Contract { return s.contract }
+
+type stack []*uint256.Int
+
+func (s stack) Back(n int) *uint256.Int { return s[len(s)-n-1] }
+func (s stack) Len() int                { return len(s) }
+
+type memory struct{}
+
+func (memory) GetCopy(int64, int64) []byte { return nil }
+func (memory) Len() int                    { return 0 }
+
+type contract struct {
+	address, caller core.Address
+}
+
+func (c *contract) AsDelegate() core.Contract  { return c }
+func (c *contract) GetOp(n uint64) core.OpCode { return 0 }
+func (c *contract) GetByte(n uint64) byte      { return 0 }
+func (c *contract) Caller() core.Address       { return c.caller }
+func (c *contract) Address() core.Address      { return c.address }
+func (c *contract) Value() *big.Int            { return new(big.Int) }
+func (c *contract) Input() []byte              { return nil }
+func (c *contract) Code() []byte               { return nil }
+
+// noState stands in for the StateDB handed to tracers, which is not
+// available outside of geth.
+type noState struct{}
+
+func (noState) GetBalance(core.Address) *big.Int                    { return new(big.Int) }
+func (noState) GetNonce(core.Address) uint64                        { return 0 }
+func (noState) GetCodeHash(core.Address) core.Hash                  { return core.Hash{} }
+func (noState) GetCode(core.Address) []byte                         { return nil }
+func (noState) GetCodeSize(core.Address) int                        { return 0 }
+func (noState) GetRefund() uint64                                   { return 0 }
+func (noState) GetCommittedState(core.Address, core.Hash) core.Hash { return core.Hash{} }
+func (noState) GetState(core.Address, core.Hash) core.Hash          { return core.Hash{} }
+func (noState) HasSuicided(core.Address) bool                       { return false }
+func (noState) Exist(core.Address) bool                             { return false }
+func (noState) Empty(core.Address) bool                             { return true }
+func (noState) AddressInAccessList(core.Address) bool               { return false }
+func (noState) SlotInAccessList(core.Address, core.Hash) (bool, bool) {
+	return false, false
+}
@@ -0,0 +1,359 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"plugin"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/plugins/remote"
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+// remoteManifestSuffix identifies manifests of plugins that run as separate
+// executables.
+const remoteManifestSuffix = ".plugin.json"
+
+// remoteStartTimeout is how long a plugin process gets to connect back to
+// geth after being launched.
+const remoteStartTimeout = 10 * time.Second
+
+// defaultRemoteTimeout is how long a plugin process gets to answer a call,
+// unless configured otherwise (see Config.RemoteTimeout).
+const defaultRemoteTimeout = 10 * time.Second
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// remoteManifest is the content of a `<name>.plugin.json` file. Exec is
+// resolved relative to the plugins directory.
+type remoteManifest struct {
+	Manifest
+	Exec string   `json:"exec"`
+	Args []string `json:"args"`
+	Env  []string `json:"env"`
+}
+
+// remotePlugin is a plugin running in its own process. It resolves hooks to
+// stubs that forward each invocation over a local socket, so that the rest of
+// the loader can treat it like a plugin opened with plugin.Open.
+type remotePlugin struct {
+	name    string
+	cmd     *exec.Cmd
+	client  *rpc.Client
+	hooks   map[string]struct{}
+	apis    []remote.API
+	tracers []string
+	dir     string
+	timeout time.Duration // for each call to the plugin process
+
+	mu   sync.Mutex
+	dead bool
+}
+
+func readRemoteManifest(fpath string) (*remoteManifest, error) {
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	m := &remoteManifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if m.Exec == "" {
+		return nil, fmt.Errorf("manifest does not specify an executable")
+	}
+	if m.Name == "" {
+		m.Name = filepath.Base(fpath[:len(fpath)-len(remoteManifestSuffix)])
+	}
+	if !filepath.IsAbs(m.Exec) {
+		m.Exec = filepath.Join(filepath.Dir(fpath), m.Exec)
+	}
+	return m, nil
+}
+
+// startRemotePlugin launches the executable described by m and waits for it
+// to connect back. Calls to the plugin fail if they take longer than timeout.
+func startRemotePlugin(m *remoteManifest, timeout time.Duration) (*remotePlugin, error) {
+	dir, err := ioutil.TempDir("", "plugeth-")
+	if err != nil {
+		return nil, err
+	}
+	sock := filepath.Join(dir, "plugin.sock")
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	defer listener.Close()
+
+	cmd := exec.Command(m.Exec, m.Args...)
+	cmd.Env = append(append(os.Environ(), m.Env...), fmt.Sprintf("%v=%v", remote.SocketEnv, sock))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	listener.(*net.UnixListener).SetDeadline(time.Now().Add(remoteStartTimeout))
+	conn, err := listener.Accept()
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("plugin process did not connect: %v", err)
+	}
+	rp, err := newRemotePlugin(m.Name, conn, timeout)
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	rp.cmd, rp.dir = cmd, dir
+	go func() {
+		err := cmd.Wait()
+		rp.mu.Lock()
+		dead := rp.dead
+		rp.dead = true
+		rp.mu.Unlock()
+		if !dead {
+			log.Error("Plugin process exited", "plugin", rp.name, "err", err)
+		}
+		os.RemoveAll(dir)
+	}()
+	return rp, nil
+}
+
+// newRemotePlugin speaks the plugin protocol over conn and asks the plugin
+// which hooks it provides. A zero timeout means defaultRemoteTimeout.
+func newRemotePlugin(name string, conn io.ReadWriteCloser, timeout time.Duration) (*remotePlugin, error) {
+	if timeout == 0 {
+		timeout = defaultRemoteTimeout
+	}
+	rp := &remotePlugin{
+		name:    name,
+		client:  rpc.NewClientWithCodec(jsonrpc.NewClientCodec(conn)),
+		hooks:   make(map[string]struct{}),
+		timeout: timeout,
+	}
+	reply := remote.HooksReply{}
+	if err := rp.call("Hooks", remote.HooksArgs{}, &reply); err != nil {
+		rp.client.Close()
+		return nil, err
+	}
+	for _, hook := range reply.Hooks {
+		rp.hooks[hook] = struct{}{}
+	}
+	rp.apis, rp.tracers = reply.APIs, reply.Tracers
+	return rp, nil
+}
+
+// Lookup returns a stub for the named hook, satisfying the same interface as
+// plugin.Plugin.Lookup.
+func (rp *remotePlugin) Lookup(name string) (plugin.Symbol, error) {
+	switch name {
+	case "GetAPIs":
+		if len(rp.apis) > 0 {
+			return rp.getAPIs, nil
+		}
+	case "Tracers":
+		if len(rp.tracers) > 0 {
+			tracers := make(map[string]func(core.StateDB, core.BlockContext) core.TracerResult)
+			for _, tracer := range rp.tracers {
+				tracer := tracer
+				tracers[tracer] = func(_ core.StateDB, ctx core.BlockContext) core.TracerResult {
+					return &remoteTracer{plugin: rp, args: remote.TraceArgs{Tracer: tracer, Context: ctx}}
+				}
+			}
+			return &tracers, nil
+		}
+	default:
+		if _, ok := rp.hooks[name]; ok {
+			t, ok := remote.HookTypes[name]
+			if !ok {
+				return nil, fmt.Errorf("hook %v cannot be served out of process", name)
+			}
+			return reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+				return rp.invoke(name, t, in)
+			}).Interface(), nil
+		}
+	}
+	return nil, fmt.Errorf("symbol %v not found in plugin %v", name, rp.name)
+}
+
+// call invokes method of the plugin process, failing if the process does not
+// answer within the timeout of the plugin. The answer to a call that timed out
+// is discarded when it arrives.
+func (rp *remotePlugin) call(method string, args, reply interface{}) error {
+	rp.mu.Lock()
+	dead := rp.dead
+	rp.mu.Unlock()
+	if dead {
+		return fmt.Errorf("plugin process is not running")
+	}
+	call := rp.client.Go(remote.ServiceName+"."+method, args, reply, make(chan *rpc.Call, 1))
+	timer := time.NewTimer(rp.timeout)
+	defer timer.Stop()
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-timer.C:
+		return fmt.Errorf("plugin process did not answer %v within %v", method, rp.timeout)
+	}
+}
+
+// invoke forwards a hook invocation. An invocation that cannot be completed,
+// such as one the plugin process fails to answer in time, raises a hookFault,
+// which guard accounts for like a panic in the plugin. The hook then returns
+// zero values, so a misbehaving plugin process cannot take geth down.
+func (rp *remotePlugin) invoke(hook string, t reflect.Type, in []reflect.Value) []reflect.Value {
+	args := remote.CallArgs{Hook: hook, Args: make([]json.RawMessage, len(in))}
+	for i, v := range in {
+		data, err := remote.Encode(v)
+		if err != nil {
+			panic(hookFault{fmt.Errorf("could not encode argument %d: %v", i, err)})
+		}
+		args.Args[i] = data
+	}
+	reply := remote.CallReply{}
+	if err := rp.call("Call", args, &reply); err != nil {
+		panic(hookFault{err})
+	}
+	out := zeroResults(t)
+	for i := 0; i < len(out) && i < len(reply.Results); i++ {
+		v, err := remote.Decode(reply.Results[i], t.Out(i))
+		if err != nil {
+			panic(hookFault{fmt.Errorf("could not decode result %d: %v", i, err)})
+		}
+		out[i] = v
+	}
+	return out
+}
+
+func (rp *remotePlugin) getAPIs(core.Node, core.Backend) []core.API {
+	apis := make([]core.API, len(rp.apis))
+	for i, api := range rp.apis {
+		svc := &remoteService{callbacks: make(map[string]interface{})}
+		for method, n := range api.Methods {
+			svc.callbacks[method] = rp.apiCallback(api.Namespace, method, n)
+		}
+		apis[i] = core.API{Namespace: api.Namespace, Version: api.Version, Service: svc, Public: api.Public}
+	}
+	return apis
+}
+
+// apiCallback builds a function taking a context followed by n raw JSON
+// parameters, which geth's RPC server can register like any other method.
+func (rp *remotePlugin) apiCallback(namespace, method string, n int) interface{} {
+	in := []reflect.Type{contextType}
+	for i := 0; i < n; i++ {
+		in = append(in, reflect.TypeOf(json.RawMessage{}))
+	}
+	out := []reflect.Type{reflect.TypeOf(json.RawMessage{}), reflect.TypeOf((*error)(nil)).Elem()}
+	t := reflect.FuncOf(in, out, false)
+	return reflect.MakeFunc(t, func(args []reflect.Value) []reflect.Value {
+		call := remote.APICallArgs{Namespace: namespace, Method: method}
+		for _, arg := range args[1:] {
+			call.Args = append(call.Args, arg.Interface().(json.RawMessage))
+		}
+		reply := remote.APICallReply{}
+		if err := rp.call("CallAPI", call, &reply); err != nil {
+			return []reflect.Value{reflect.Zero(out[0]), reflect.ValueOf(&err).Elem()}
+		}
+		if reply.Result == nil {
+			reply.Result = json.RawMessage("null")
+		}
+		return []reflect.Value{reflect.ValueOf(reply.Result), reflect.Zero(out[1])}
+	}).Interface()
+}
+
+// close stops the plugin process.
+func (rp *remotePlugin) close() {
+	rp.mu.Lock()
+	if rp.dead {
+		rp.mu.Unlock()
+		return
+	}
+	rp.dead = true
+	rp.mu.Unlock()
+	rp.client.Close()
+	if rp.cmd != nil && rp.cmd.Process != nil {
+		rp.cmd.Process.Signal(os.Interrupt)
+	}
+}
+
+// remoteService is registered with geth's RPC server on behalf of a plugin
+// process. The RPC server picks up its methods through PluginCallbacks.
+type remoteService struct {
+	callbacks map[string]interface{}
+}
+
+func (s *remoteService) PluginCallbacks() map[string]interface{} {
+	return s.callbacks
+}
+
+// remoteTracer records tracer callbacks and replays them in the plugin
+// process when the result is requested.
+type remoteTracer struct {
+	plugin *remotePlugin
+	args   remote.TraceArgs
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func scopeEvent(kind string, pc uint64, op core.OpCode, gas, cost uint64, scope core.ScopeContext, depth int, err error) remote.TraceEvent {
+	ev := remote.TraceEvent{Kind: kind, PC: pc, Op: op, Gas: gas, Cost: cost, Depth: depth, Error: errString(err)}
+	if scope != nil {
+		stack := scope.Stack()
+		ev.Stack = make([]string, stack.Len())
+		for i := range ev.Stack {
+			ev.Stack[i] = stack.Back(len(ev.Stack) - i - 1).Hex()
+		}
+		ev.Contract, ev.Caller = scope.Contract().Address(), scope.Contract().Caller()
+	}
+	return ev
+}
+
+func (t *remoteTracer) CaptureStart(from core.Address, to core.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.args.Events = append(t.args.Events, remote.TraceEvent{Kind: "start", From: from, To: to, Create: create, Input: input, Gas: gas, Value: value})
+}
+func (t *remoteTracer) CaptureState(pc uint64, op core.OpCode, gas, cost uint64, scope core.ScopeContext, rData []byte, depth int, err error) {
+	t.args.Events = append(t.args.Events, scopeEvent("state", pc, op, gas, cost, scope, depth, err))
+}
+func (t *remoteTracer) CaptureFault(pc uint64, op core.OpCode, gas, cost uint64, scope core.ScopeContext, depth int, err error) {
+	t.args.Events = append(t.args.Events, scopeEvent("fault", pc, op, gas, cost, scope, depth, err))
+}
+func (t *remoteTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+	t.args.Events = append(t.args.Events, remote.TraceEvent{Kind: "end", Output: output, GasUsed: gasUsed, Duration: d, Error: errString(err)})
+}
+func (t *remoteTracer) CaptureEnter(typ core.OpCode, from core.Address, to core.Address, input []byte, gas uint64, value *big.Int) {
+	t.args.Events = append(t.args.Events, remote.TraceEvent{Kind: "enter", Op: typ, From: from, To: to, Input: input, Gas: gas, Value: value})
+}
+func (t *remoteTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	t.args.Events = append(t.args.Events, remote.TraceEvent{Kind: "exit", Output: output, GasUsed: gasUsed, Error: errString(err)})
+}
+func (t *remoteTracer) Result() (interface{}, error) {
+	reply := remote.TraceReply{}
+	if err := t.plugin.call("Trace", t.args, &reply); err != nil {
+		return nil, err
+	}
+	return reply.Result, nil
+}
@@ -0,0 +1,209 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/plugins/freezer"
+	"github.com/ethereum/go-ethereum/plugins/remote"
+	"github.com/ethereum/go-ethereum/plugins/statediff"
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+// testPluginEnv makes the test binary serve as a plugin process.
+const testPluginEnv = "PLUGETH_TEST_PLUGIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(testPluginEnv) != "" {
+		remote.Main(&remote.Plugin{Hooks: map[string]interface{}{"PostProcessBlock": func(core.Hash) {}}})
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+type testRemoteService struct{}
+
+func (s *testRemoteService) Add(ctx context.Context, a, b int) (int, error) {
+	return a + b, nil
+}
+
+func newTestRemotePlugin(t *testing.T, p *remote.Plugin, timeout time.Duration) *remotePlugin {
+	server, client := net.Pipe()
+	go remote.Serve(server, p)
+	rp, err := newRemotePlugin("test", client, timeout)
+	if err != nil {
+		t.Fatalf("Could not connect to remote plugin: %v", err)
+	}
+	t.Cleanup(rp.close)
+	return rp
+}
+
+func TestRemotePluginHooks(t *testing.T) {
+	var (
+		gotHash  core.Hash
+		gotLogs  [][]byte
+		gotTd    *big.Int
+		gotStore map[core.Hash]map[core.Hash][]byte
+		gotDiff  map[core.Address]*statediff.AccountDiff
+		gotBatch []*freezer.Block
+	)
+	rp := newTestRemotePlugin(t, &remote.Plugin{
+		Hooks: map[string]interface{}{
+			"NewHead": func(block []byte, hash core.Hash, logs [][]byte, td *big.Int) {
+				gotHash, gotLogs, gotTd = hash, logs, td
+			},
+			"StateUpdate": func(root, parent core.Hash, destructs map[core.Hash]struct{}, accounts map[core.Hash][]byte, storage map[core.Hash]map[core.Hash][]byte, code map[core.Hash][]byte) {
+				gotStore = storage
+			},
+			"StateDiff": func(root, parent core.Hash, diff map[core.Address]*statediff.AccountDiff) {
+				gotDiff = diff
+			},
+			"FreezerBatch": func(blocks []*freezer.Block) {
+				gotBatch = blocks
+			},
+			"PostProcessBlock": func(core.Hash) {
+				panic("faulty plugin")
+			},
+			"PreProcessTransaction": func(tx []byte, hash, block core.Hash, i int) {
+				time.Sleep(time.Second)
+			},
+		},
+	}, 100*time.Millisecond)
+	pl := &PluginLoader{
+		Plugins:     []pluginDetails{{p: rp, name: "test", provides: make(map[string]struct{})}},
+		LookupCache: make(map[string][]interface{}),
+	}
+	fns := pl.Lookup("NewHead", func(item interface{}) bool {
+		_, ok := item.(func([]byte, core.Hash, [][]byte, *big.Int))
+		return ok
+	})
+	if len(fns) != 1 {
+		t.Fatalf("Expected one NewHead hook, got %d", len(fns))
+	}
+	fns[0].(func([]byte, core.Hash, [][]byte, *big.Int))([]byte{1}, core.Hash{2}, [][]byte{{3}}, big.NewInt(4))
+	if gotHash != (core.Hash{2}) || len(gotLogs) != 1 || gotLogs[0][0] != 3 || gotTd.Int64() != 4 {
+		t.Errorf("Unexpected NewHead arguments: %v %v %v", gotHash, gotLogs, gotTd)
+	}
+
+	fn, err := rp.Lookup("StateUpdate")
+	if err != nil {
+		t.Fatalf("Expected StateUpdate hook: %v", err)
+	}
+	storage := map[core.Hash]map[core.Hash][]byte{{1}: {{2}: {3}}}
+	fn.(func(core.Hash, core.Hash, map[core.Hash]struct{}, map[core.Hash][]byte, map[core.Hash]map[core.Hash][]byte, map[core.Hash][]byte))(core.Hash{}, core.Hash{}, nil, nil, storage, nil)
+	if v := gotStore[core.Hash{1}][core.Hash{2}]; len(v) != 1 || v[0] != 3 {
+		t.Errorf("Unexpected storage %v", gotStore)
+	}
+
+	fn, err = rp.Lookup("StateDiff")
+	if err != nil {
+		t.Fatalf("Expected StateDiff hook: %v", err)
+	}
+	diff := map[core.Address]*statediff.AccountDiff{{1}: {
+		After:   &statediff.Account{Nonce: 1, Balance: big.NewInt(2), CodeHash: core.Hash{3}},
+		Storage: map[core.Hash]statediff.Slot{{4}: {After: core.Hash{5}}},
+	}}
+	fn.(func(core.Hash, core.Hash, map[core.Address]*statediff.AccountDiff))(core.Hash{}, core.Hash{}, diff)
+	if d := gotDiff[core.Address{1}]; d == nil || d.Before != nil || !reflect.DeepEqual(d.After, diff[core.Address{1}].After) || d.Storage[core.Hash{4}].After != (core.Hash{5}) {
+		t.Errorf("Unexpected state diff %v", gotDiff)
+	}
+
+	fn, err = rp.Lookup("FreezerBatch")
+	if err != nil {
+		t.Fatalf("Expected FreezerBatch hook: %v", err)
+	}
+	batch := []*freezer.Block{{Number: 1, Hash: core.Hash{2}, Header: []byte{3}, Td: big.NewInt(4)}}
+	fn.(func([]*freezer.Block))(batch)
+	if len(gotBatch) != 1 || !reflect.DeepEqual(gotBatch[0], batch[0]) {
+		t.Errorf("Unexpected freezer batch %v", gotBatch)
+	}
+
+	// Panics in the plugin process and calls timing out are faults of the plugin
+	for _, fni := range pl.Lookup("PostProcessBlock", func(interface{}) bool { return true }) {
+		fni.(func(core.Hash))(core.Hash{})
+	}
+	start := time.Now()
+	for _, fni := range pl.Lookup("PreProcessTransaction", func(interface{}) bool { return true }) {
+		fni.(func([]byte, core.Hash, core.Hash, int))(nil, core.Hash{}, core.Hash{}, 0)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected call to time out, took %v", elapsed)
+	}
+	if faults := pl.PluginInfo()[0].Faults; faults != 2 {
+		t.Errorf("Expected 2 faults, got %d", faults)
+	}
+
+	if _, err := rp.Lookup("PreProcessBlock"); err == nil {
+		t.Errorf("Expected missing hook to fail lookup")
+	}
+}
+
+func TestRemotePluginAPIs(t *testing.T) {
+	rp := newTestRemotePlugin(t, &remote.Plugin{
+		APIs: []core.API{{Namespace: "test", Version: "1.0", Service: &testRemoteService{}, Public: true}},
+	}, 0)
+	fn, err := rp.Lookup("GetAPIs")
+	if err != nil {
+		t.Fatalf("Expected GetAPIs hook: %v", err)
+	}
+	apis := fn.(func(core.Node, core.Backend) []core.API)(nil, nil)
+	if len(apis) != 1 || apis[0].Namespace != "test" {
+		t.Fatalf("Unexpected APIs %v", apis)
+	}
+	callbacks := apis[0].Service.(*remoteService).PluginCallbacks()
+	add, ok := callbacks["add"].(func(context.Context, json.RawMessage, json.RawMessage) (json.RawMessage, error))
+	if !ok {
+		t.Fatalf("Unexpected callback type %T", callbacks["add"])
+	}
+	result, err := add(context.Background(), json.RawMessage("2"), json.RawMessage("3"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if string(result) != "5" {
+		t.Errorf("Expected 5, got %s", result)
+	}
+}
+
+func TestRemotePluginEnabledByName(t *testing.T) {
+	exec, err := os.Executable()
+	if err != nil {
+		t.Skipf("Test binary unavailable: %v", err)
+	}
+	dir := t.TempDir()
+	manifest, _ := json.Marshal(remoteManifest{
+		Manifest: Manifest{Name: "indexer", APIVersion: APIVersion},
+		Exec:     exec,
+		Env:      []string{testPluginEnv + "=1"},
+	})
+	if err := os.WriteFile(filepath.Join(dir, "indexer-v2"+remoteManifestSuffix), manifest, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		cfg    Config
+		loaded bool
+	}{
+		{Config{Enable: []string{"indexer"}}, true},
+		{Config{Enable: []string{"indexer-v2"}}, true},
+		{Config{Enable: []string{"other"}}, false},
+		{Config{Enable: []string{"indexer"}, Disable: []string{"indexer-v2"}}, false},
+		{Config{Disable: []string{"indexer"}}, false},
+	}
+	for i, tt := range tests {
+		tt.cfg.Dir = dir
+		pl, err := NewPluginLoader(tt.cfg)
+		if err != nil {
+			t.Fatalf("test %d: %v", i, err)
+		}
+		if loaded := len(pl.Plugins) == 1 && pl.Plugins[0].name == "indexer"; loaded != tt.loaded {
+			t.Errorf("test %d: expected loaded=%v, got %d plugins", i, tt.loaded, len(pl.Plugins))
+		}
+		pl.Close()
+	}
+}
@@ -0,0 +1,36 @@
+// Package statediff defines the values delivered to StateDiff plugins. It only
+// depends on plugeth-utils, so plugins, in process or not, can use it without
+// importing the state package of geth.
+package statediff
+
+import (
+	"math/big"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+// Account is an account as of the start or the end of a block.
+type Account struct {
+	Nonce       uint64    `json:"nonce"`
+	Balance     *big.Int  `json:"balance"`
+	CodeHash    core.Hash `json:"codeHash"`
+	StorageRoot core.Hash `json:"storageRoot"`
+}
+
+// Slot is the value of a storage slot before and after a block.
+type Slot struct {
+	Before core.Hash `json:"before"`
+	After  core.Hash `json:"after"`
+}
+
+// AccountDiff describes how an account changed in a block. Before is nil for
+// accounts that did not exist, and After for accounts deleted by the block.
+// Destructed is set when the storage of the account was cleared, by a self
+// destruct or a deletion; Storage then holds the slots set afterwards, with
+// zero Before values.
+type AccountDiff struct {
+	Before     *Account           `json:"before"`
+	After      *Account           `json:"after"`
+	Destructed bool               `json:"destructed"`
+	Storage    map[core.Hash]Slot `json:"storage,omitempty"`
+}
@@ -0,0 +1,79 @@
+package plugins
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// hookTimer aggregates the execution times of one hook of one plugin.
+type hookTimer struct {
+	lock  sync.Mutex
+	calls uint64
+	total time.Duration
+	max   time.Duration
+}
+
+func (t *hookTimer) record(elapsed time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.calls++
+	t.total += elapsed
+	if elapsed > t.max {
+		t.max = elapsed
+	}
+}
+
+// HookStats holds the aggregated execution times of a plugin hook. Durations
+// are in nanoseconds.
+type HookStats struct {
+	Plugin string        `json:"plugin"`
+	Hook   string        `json:"hook"`
+	Calls  uint64        `json:"calls"`
+	Total  time.Duration `json:"total"`
+	Mean   time.Duration `json:"mean"`
+	Max    time.Duration `json:"max"`
+}
+
+// hookStats returns the timer of the given plugin hook, creating it if needed.
+func (pl *PluginLoader) hookStats(plugin, hook string) *hookTimer {
+	pl.statsLock.Lock()
+	defer pl.statsLock.Unlock()
+	if pl.stats == nil {
+		pl.stats = make(map[[2]string]*hookTimer)
+	}
+	key := [2]string{plugin, hook}
+	if _, ok := pl.stats[key]; !ok {
+		pl.stats[key] = &hookTimer{}
+	}
+	return pl.stats[key]
+}
+
+// HookStats returns the execution times of every hook invoked through the
+// loader, sorted by plugin and hook name.
+func (pl *PluginLoader) HookStats() []HookStats {
+	pl.statsLock.Lock()
+	defer pl.statsLock.Unlock()
+	result := make([]HookStats, 0, len(pl.stats))
+	for key, t := range pl.stats {
+		t.lock.Lock()
+		s := HookStats{Plugin: key[0], Hook: key[1], Calls: t.calls, Total: t.total, Max: t.max}
+		t.lock.Unlock()
+		if s.Calls > 0 {
+			s.Mean = s.Total / time.Duration(s.Calls)
+		}
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Plugin != result[j].Plugin {
+			return result[i].Plugin < result[j].Plugin
+		}
+		return result[i].Hook < result[j].Hook
+	})
+	return result
+}
+
+// HookStats returns the aggregated execution times of plugin hooks.
+func (api *API) HookStats() []HookStats {
+	return api.pl.HookStats()
+}
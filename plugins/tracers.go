@@ -0,0 +1,146 @@
+package plugins
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"time"
+
+	"github.com/openrelayxyz/plugeth-utils/core"
+)
+
+var (
+	tracerResultType = reflect.TypeOf((*core.TracerResult)(nil)).Elem()
+	blockTracerType  = reflect.TypeOf((*core.BlockTracer)(nil)).Elem()
+)
+
+// guardTracers guards the tracer constructors exported by plugin for the
+// Tracers hook, reporting whether v holds them.
+func (pl *PluginLoader) guardTracers(plugin pluginDetails, hook string, v interface{}) (interface{}, bool) {
+	switch tracers := v.(type) {
+	case *map[string]func(core.StateDB) core.TracerResult:
+		guarded := make(map[string]func(core.StateDB) core.TracerResult, len(*tracers))
+		for name, fn := range *tracers {
+			guarded[name] = pl.guard(plugin, hook, fn, false).(func(core.StateDB) core.TracerResult)
+		}
+		return &guarded, true
+	case *map[string]func(core.StateDB, core.BlockContext) core.TracerResult:
+		guarded := make(map[string]func(core.StateDB, core.BlockContext) core.TracerResult, len(*tracers))
+		for name, fn := range *tracers {
+			guarded[name] = pl.guard(plugin, hook, fn, false).(func(core.StateDB, core.BlockContext) core.TracerResult)
+		}
+		return &guarded, true
+	}
+	return nil, false
+}
+
+// guardResult guards a tracer returned by a hook of plugin. Other results are
+// returned as-is.
+func (pl *PluginLoader) guardResult(plugin pluginDetails, hook string, result reflect.Value) reflect.Value {
+	if result.Kind() != reflect.Interface || result.IsNil() {
+		return result
+	}
+	tracer := &guardedTracer{pl: pl, plugin: plugin, hook: hook}
+	switch result.Type() {
+	case blockTracerType:
+		tracer.tracer = result.Interface().(core.BlockTracer)
+		return reflect.ValueOf(&guardedBlockTracer{tracer}).Convert(blockTracerType)
+	case tracerResultType:
+		tracer.tracer = result.Interface().(core.TracerResult)
+		return reflect.ValueOf(tracer).Convert(tracerResultType)
+	}
+	return result
+}
+
+// guardedTracer isolates the caller of a tracer returned by a plugin from
+// panics in its methods, which are accounted for as faults of the hook that
+// returned the tracer. The methods of a tracer of a quarantined plugin do
+// nothing.
+type guardedTracer struct {
+	pl     *PluginLoader
+	plugin pluginDetails
+	hook   string
+	tracer core.TracerResult
+}
+
+// call invokes fn unless the plugin is quarantined, recovering its faults.
+func (t *guardedTracer) call(fn func()) (err error) {
+	if t.plugin.health.isQuarantined() {
+		return fmt.Errorf("plugin %v is quarantined", t.plugin.prefix())
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = t.pl.fault(t.plugin, t.hook, r)
+		}
+	}()
+	fn()
+	return nil
+}
+
+func (t *guardedTracer) CaptureStart(from core.Address, to core.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.call(func() { t.tracer.CaptureStart(from, to, create, input, gas, value) })
+}
+
+func (t *guardedTracer) CaptureState(pc uint64, op core.OpCode, gas, cost uint64, scope core.ScopeContext, rData []byte, depth int, err error) {
+	t.call(func() { t.tracer.CaptureState(pc, op, gas, cost, scope, rData, depth, err) })
+}
+
+func (t *guardedTracer) CaptureFault(pc uint64, op core.OpCode, gas, cost uint64, scope core.ScopeContext, depth int, err error) {
+	t.call(func() { t.tracer.CaptureFault(pc, op, gas, cost, scope, depth, err) })
+}
+
+func (t *guardedTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {
+	t.call(func() { t.tracer.CaptureEnd(output, gasUsed, d, err) })
+}
+
+func (t *guardedTracer) CaptureEnter(typ core.OpCode, from core.Address, to core.Address, input []byte, gas uint64, value *big.Int) {
+	t.call(func() { t.tracer.CaptureEnter(typ, from, to, input, gas, value) })
+}
+
+func (t *guardedTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	t.call(func() { t.tracer.CaptureExit(output, gasUsed, err) })
+}
+
+// CapturePreStart forwards to tracers implementing core.PreTracer.
+func (t *guardedTracer) CapturePreStart(from core.Address, to *core.Address, input []byte, gas uint64, value *big.Int) {
+	if pre, ok := t.tracer.(core.PreTracer); ok {
+		t.call(func() { pre.CapturePreStart(from, to, input, gas, value) })
+	}
+}
+
+// Result returns the result of the tracer, or the fault preventing it.
+func (t *guardedTracer) Result() (result interface{}, err error) {
+	if fault := t.call(func() { result, err = t.tracer.Result() }); fault != nil {
+		return nil, fault
+	}
+	return result, err
+}
+
+// guardedBlockTracer is a guardedTracer of a core.BlockTracer.
+type guardedBlockTracer struct {
+	*guardedTracer
+}
+
+func (t *guardedBlockTracer) blockTracer() core.BlockTracer {
+	return t.tracer.(core.BlockTracer)
+}
+
+func (t *guardedBlockTracer) PreProcessBlock(hash core.Hash, number uint64, encoded []byte) {
+	t.call(func() { t.blockTracer().PreProcessBlock(hash, number, encoded) })
+}
+
+func (t *guardedBlockTracer) PreProcessTransaction(tx core.Hash, block core.Hash, i int) {
+	t.call(func() { t.blockTracer().PreProcessTransaction(tx, block, i) })
+}
+
+func (t *guardedBlockTracer) BlockProcessingError(tx core.Hash, block core.Hash, err error) {
+	t.call(func() { t.blockTracer().BlockProcessingError(tx, block, err) })
+}
+
+func (t *guardedBlockTracer) PostProcessTransaction(tx core.Hash, block core.Hash, i int, receipt []byte) {
+	t.call(func() { t.blockTracer().PostProcessTransaction(tx, block, i, receipt) })
+}
+
+func (t *guardedBlockTracer) PostProcessBlock(block core.Hash) {
+	t.call(func() { t.blockTracer().PostProcessBlock(block) })
+}
@@ -1,6 +1,7 @@
 package wrappers
 
 import (
+	"errors"
 	"math/big"
 	"time"
 	"encoding/json"
@@ -8,8 +9,10 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/openrelayxyz/plugeth-utils/core"
+	"github.com/openrelayxyz/plugeth-utils/restricted"
 )
 
 type WrappedScopeContext struct {
@@ -231,6 +234,46 @@ func (n *Node) Close() error {
 	return n.n.Close()
 }
 
+// WrappedDatabase exposes an ethdb.Database to plugins as a
+// restricted.Database. Plugins cannot truncate the freezer or close the
+// database, which geth owns.
+type WrappedDatabase struct {
+	db ethdb.Database
+}
+
+func NewWrappedDatabase(db ethdb.Database) *WrappedDatabase {
+	return &WrappedDatabase{db}
+}
+
+func (d *WrappedDatabase) Has(key []byte) (bool, error)             { return d.db.Has(key) }
+func (d *WrappedDatabase) Get(key []byte) ([]byte, error)           { return d.db.Get(key) }
+func (d *WrappedDatabase) Put(key []byte, value []byte) error       { return d.db.Put(key, value) }
+func (d *WrappedDatabase) Delete(key []byte) error                  { return d.db.Delete(key) }
+func (d *WrappedDatabase) Stat(property string) (string, error)     { return d.db.Stat(property) }
+func (d *WrappedDatabase) Compact(start []byte, limit []byte) error { return d.db.Compact(start, limit) }
+func (d *WrappedDatabase) HasAncient(kind string, number uint64) (bool, error) {
+	return d.db.HasAncient(kind, number)
+}
+func (d *WrappedDatabase) Ancient(kind string, number uint64) ([]byte, error) {
+	return d.db.Ancient(kind, number)
+}
+func (d *WrappedDatabase) Ancients() (uint64, error)               { return d.db.Ancients() }
+func (d *WrappedDatabase) AncientSize(kind string) (uint64, error) { return d.db.AncientSize(kind) }
+func (d *WrappedDatabase) AppendAncient(number uint64, hash, header, body, receipt, td []byte) error {
+	return errors.New("AppendAncient is no longer supported in geth 1.10.9 and above. Use ModifyAncients instead.")
+}
+func (d *WrappedDatabase) ModifyAncients(fn func(ethdb.AncientWriteOp) error) (int64, error) {
+	return d.db.ModifyAncients(fn)
+}
+func (d *WrappedDatabase) TruncateAncients(n uint64) error {
+	return errors.New("TruncateAncients is no longer supported in geth 1.10.17 and above.")
+}
+func (d *WrappedDatabase) Sync() error  { return d.db.Sync() }
+func (d *WrappedDatabase) Close() error { return nil }
+func (d *WrappedDatabase) NewIterator(prefix []byte, start []byte) restricted.Iterator {
+	return d.db.NewIterator(prefix, start)
+}
+
 // type WrappedBlockContext struct {
 // 	b vm.BlockContext
 // }
@@ -632,7 +632,9 @@ func (c *Client) read(codec ServerCodec) {
 	for {
 		msgs, batch, err := codec.readBatch()
 		if _, ok := err.(*json.SyntaxError); ok {
-			codec.writeJSON(context.Background(), errorMessage(&parseError{err.Error()}))
+			resp := errorMessage(&parseError{err.Error()})
+			pluginRPCCallAnswered(nil, resp, 0)
+			codec.writeJSON(context.Background(), resp)
 		}
 		if err != nil {
 			c.readErr <- err
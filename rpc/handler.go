@@ -114,12 +114,14 @@ func (h *handler) handleBatch(msgs []*jsonrpcMessage) {
 	}
 	// Process calls on a goroutine because they may block indefinitely:
 	h.startCallProc(func(cp *callProc) {
+		start := time.Now()
 		answers := make([]*jsonrpcMessage, 0, len(msgs))
 		for _, msg := range calls {
 			if answer := h.handleCallMsg(cp, msg); answer != nil {
 				answers = append(answers, answer)
 			}
 		}
+		pluginRPCBatchComplete(calls, time.Since(start))
 		h.addSubscriptions(cp.notifiers)
 		if len(answers) > 0 {
 			h.conn.writeJSON(cp.ctx, answers)
@@ -291,11 +293,11 @@ func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMess
 	start := time.Now()
 	switch {
 	case msg.isNotification():
-		h.handleCall(ctx, msg)
+		h.handlePluginCall(ctx, msg)
 		h.log.Debug("Served "+msg.Method, "duration", time.Since(start))
 		return nil
 	case msg.isCall():
-		resp := h.handleCall(ctx, msg)
+		resp := h.handlePluginCall(ctx, msg)
 		var ctx []interface{}
 		ctx = append(ctx, "reqid", idForLog{msg.ID}, "duration", time.Since(start))
 		if resp.Error != nil {
@@ -309,9 +311,13 @@ func (h *handler) handleCallMsg(ctx *callProc, msg *jsonrpcMessage) *jsonrpcMess
 		}
 		return resp
 	case msg.hasValidID():
-		return msg.errorResponse(&invalidRequestError{"invalid request"})
+		resp := msg.errorResponse(&invalidRequestError{"invalid request"})
+		pluginRPCCallAnswered(msg, resp, time.Since(start))
+		return resp
 	default:
-		return errorMessage(&invalidRequestError{"invalid request"})
+		resp := errorMessage(&invalidRequestError{"invalid request"})
+		pluginRPCCallAnswered(msg, resp, time.Since(start))
+		return resp
 	}
 }
 
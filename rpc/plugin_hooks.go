@@ -1,6 +1,10 @@
 package rpc
 
 import (
+	"encoding/json"
+	"errors"
+	"time"
+
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/plugins"
 )
@@ -24,3 +28,169 @@ func pluginGetRPCCalls(id, method, params string) {
 	}
 	PluginGetRPCCalls(plugins.DefaultPluginLoader, id, method, params)
 }
+
+// PluginRPCCallRequest runs a call through the RPCCallRequest hooks, which act
+// as middleware. Each hook receives the transport ("http", "ws" or "ipc") and
+// the remote address of the client, the method and the params of the call as
+// rewritten by the preceding hooks. A hook can reject the call by returning an
+// error, which is sent to the client as the JSON-RPC error, answer the call by
+// returning a result, or return params replacing those of the call.
+func PluginRPCCallRequest(pl *plugins.PluginLoader, info PeerInfo, method string, params json.RawMessage) (json.RawMessage, json.RawMessage, error) {
+	fnList := pl.Lookup("RPCCallRequest", func(item interface{}) bool {
+		_, ok := item.(func(string, string, string, json.RawMessage) (json.RawMessage, json.RawMessage, error))
+		return ok
+	})
+	for _, fni := range fnList {
+		fn, ok := fni.(func(string, string, string, json.RawMessage) (json.RawMessage, json.RawMessage, error))
+		if !ok {
+			continue
+		}
+		newParams, result, err := fn(info.Transport, info.RemoteAddr, method, params)
+		if err != nil || result != nil {
+			return params, result, err
+		}
+		if newParams != nil {
+			params = newParams
+		}
+	}
+	return params, nil, nil
+}
+
+func pluginRPCCallRequest(info PeerInfo, method string, params json.RawMessage) (json.RawMessage, json.RawMessage, error) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting RPCCallRequest, but default PluginLoader has not been initialized")
+		return params, nil, nil
+	}
+	return PluginRPCCallRequest(plugins.DefaultPluginLoader, info, method, params)
+}
+
+// PluginRPCCallResponse runs the result of a successful call through the
+// RPCCallResponse hooks, in the reverse order of the RPCCallRequest hooks. A
+// hook can replace the result by returning a non-nil one.
+func PluginRPCCallResponse(pl *plugins.PluginLoader, info PeerInfo, method string, result json.RawMessage) json.RawMessage {
+	fnList := pl.Lookup("RPCCallResponse", func(item interface{}) bool {
+		_, ok := item.(func(string, string, string, json.RawMessage) json.RawMessage)
+		return ok
+	})
+	for i := len(fnList) - 1; i >= 0; i-- {
+		if fn, ok := fnList[i].(func(string, string, string, json.RawMessage) json.RawMessage); ok {
+			wrapped := fn(info.Transport, info.RemoteAddr, method, result)
+			if wrapped == nil {
+				continue
+			}
+			if !json.Valid(wrapped) {
+				log.Warn("Ignoring invalid RPC result from plugin", "method", method)
+				continue
+			}
+			result = wrapped
+		}
+	}
+	return result
+}
+
+func pluginRPCCallResponse(info PeerInfo, method string, result json.RawMessage) json.RawMessage {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting RPCCallResponse, but default PluginLoader has not been initialized")
+		return result
+	}
+	return PluginRPCCallResponse(plugins.DefaultPluginLoader, info, method, result)
+}
+
+// errInvalidPluginResult is returned to the client if a plugin answers a call
+// with invalid JSON.
+var errInvalidPluginResult = errors.New("invalid result from plugin")
+
+// handlePluginCall processes a method call passed through the RPC middleware
+// hooks of plugins, notifying the RPCCallComplete hooks of its answer.
+func (h *handler) handlePluginCall(cp *callProc, msg *jsonrpcMessage) (resp *jsonrpcMessage) {
+	start := time.Now()
+	defer func() { pluginRPCCallAnswered(msg, resp, time.Since(start)) }()
+
+	info := PeerInfoFromContext(cp.ctx)
+	params, result, err := pluginRPCCallRequest(info, msg.Method, msg.Params)
+	switch {
+	case err != nil:
+		return msg.errorResponse(err)
+	case result != nil:
+		if !json.Valid(result) {
+			return msg.errorResponse(errInvalidPluginResult)
+		}
+		return &jsonrpcMessage{Version: vsn, ID: msg.ID, Result: result}
+	}
+	if params != nil {
+		rewritten := *msg
+		rewritten.Params = params
+		msg = &rewritten
+	}
+	resp = h.handleCall(cp, msg)
+	if resp.Error == nil {
+		resp.Result = pluginRPCCallResponse(info, msg.Method, resp.Result)
+	}
+	return resp
+}
+
+// PluginRPCCallComplete notifies plugins of a method call having been answered,
+// with the time taken and either its result or its error. It is invoked for
+// every call, including those answered or rejected by the RPCCallRequest
+// hooks, calls of unknown methods, invalid requests and messages that could not
+// be parsed, which have neither an ID nor a method. It is invoked for the calls
+// of batches and for subscriptions too, whose result is the subscription ID.
+func PluginRPCCallComplete(pl *plugins.PluginLoader, id, method string, duration time.Duration, result json.RawMessage, err error) {
+	fnList := pl.Lookup("RPCCallComplete", func(item interface{}) bool {
+		_, ok := item.(func(string, string, time.Duration, json.RawMessage, error))
+		return ok
+	})
+	for _, fni := range fnList {
+		if fn, ok := fni.(func(string, string, time.Duration, json.RawMessage, error)); ok {
+			fn(id, method, duration, result, err)
+		}
+	}
+}
+
+func pluginRPCCallComplete(id, method string, duration time.Duration, result json.RawMessage, err error) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting RPCCallComplete, but default PluginLoader has not been initialized")
+		return
+	}
+	PluginRPCCallComplete(plugins.DefaultPluginLoader, id, method, duration, result, err)
+}
+
+// pluginRPCCallAnswered notifies plugins of msg having been answered by resp.
+// msg is nil for messages that could not be parsed.
+func pluginRPCCallAnswered(msg, resp *jsonrpcMessage, duration time.Duration) {
+	var id, method string
+	if msg != nil {
+		id, method = string(msg.ID), msg.Method
+	}
+	if resp.Error != nil {
+		pluginRPCCallComplete(id, method, duration, nil, resp.Error)
+	} else {
+		pluginRPCCallComplete(id, method, duration, resp.Result, nil)
+	}
+}
+
+// PluginRPCBatchComplete notifies plugins of a batch having been served, with
+// the IDs of the calls it held and the time taken to serve all of them.
+func PluginRPCBatchComplete(pl *plugins.PluginLoader, ids []string, duration time.Duration) {
+	fnList := pl.Lookup("RPCBatchComplete", func(item interface{}) bool {
+		_, ok := item.(func([]string, time.Duration))
+		return ok
+	})
+	for _, fni := range fnList {
+		if fn, ok := fni.(func([]string, time.Duration)); ok {
+			fn(ids, duration)
+		}
+	}
+}
+
+func pluginRPCBatchComplete(calls []*jsonrpcMessage, duration time.Duration) {
+	if plugins.DefaultPluginLoader == nil {
+		log.Warn("Attempting RPCBatchComplete, but default PluginLoader has not been initialized")
+		return
+	}
+	ids := make([]string, len(calls))
+	for i, msg := range calls {
+		ids[i] = string(msg.ID)
+	}
+	PluginRPCBatchComplete(plugins.DefaultPluginLoader, ids, duration)
+}
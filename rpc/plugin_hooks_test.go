@@ -0,0 +1,221 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/plugins"
+)
+
+func TestRPCMiddlewareHooks(t *testing.T) {
+	var transports []string
+	old := plugins.DefaultPluginLoader
+	plugins.DefaultPluginLoader = &plugins.PluginLoader{
+		LookupCache: map[string][]interface{}{
+			"RPCCallRequest": {func(transport, remoteAddr, method string, params json.RawMessage) (json.RawMessage, json.RawMessage, error) {
+				transports = append(transports, transport)
+				switch method {
+				case "test_noArgsRets":
+					return nil, nil, errors.New("method not allowed")
+				case "test_returnError":
+					return nil, json.RawMessage(`"cached"`), nil
+				case "test_echo":
+					return json.RawMessage(`["rewritten", 2, {"S": "x"}]`), nil, nil
+				}
+				return nil, nil, nil
+			}},
+			"RPCCallResponse": {func(transport, remoteAddr, method string, result json.RawMessage) json.RawMessage {
+				if method == "test_echo" {
+					return json.RawMessage(`{"wrapped":` + string(result) + `}`)
+				}
+				return nil
+			}},
+		},
+	}
+	defer func() { plugins.DefaultPluginLoader = old }()
+
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	if err := client.Call(nil, "test_noArgsRets"); err == nil || err.Error() != "method not allowed" {
+		t.Errorf("Expected call to be rejected, got %v", err)
+	}
+	var cached string
+	if err := client.Call(&cached, "test_returnError"); err != nil || cached != "cached" {
+		t.Errorf("Expected cached response, got %q, %v", cached, err)
+	}
+	var wrapped struct{ Wrapped echoResult }
+	if err := client.Call(&wrapped, "test_echo", "hello", 1, &echoArgs{"y"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if wrapped.Wrapped.String != "rewritten" || wrapped.Wrapped.Int != 2 || wrapped.Wrapped.Args.S != "x" {
+		t.Errorf("Expected rewritten params and wrapped result, got %+v", wrapped)
+	}
+	if len(transports) != 3 || transports[0] != "ipc" {
+		t.Errorf("Unexpected transports %v", transports)
+	}
+}
+
+func TestRPCCallCompleteHooks(t *testing.T) {
+	type call struct {
+		method string
+		result string
+		err    error
+	}
+	var (
+		mu      sync.Mutex
+		calls   = make(map[string]call)
+		batches [][]string
+	)
+	old := plugins.DefaultPluginLoader
+	plugins.DefaultPluginLoader = &plugins.PluginLoader{
+		LookupCache: map[string][]interface{}{
+			"RPCCallComplete": {func(id, method string, duration time.Duration, result json.RawMessage, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				calls[id] = call{method, string(result), err}
+			}},
+			"RPCBatchComplete": {func(ids []string, duration time.Duration) {
+				mu.Lock()
+				defer mu.Unlock()
+				batches = append(batches, ids)
+			}},
+		},
+	}
+	defer func() { plugins.DefaultPluginLoader = old }()
+
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	batch := []BatchElem{
+		{Method: "test_echo", Args: []interface{}{"hello", 1, &echoArgs{"x"}}, Result: new(echoResult)},
+		{Method: "test_returnError", Result: new(interface{})},
+	}
+	if err := client.BatchCall(batch); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sub, err := client.Subscribe(context.Background(), "nftest", make(chan int), "someSubscription", 1, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	sub.Unsubscribe()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("Unexpected batches %v", batches)
+	}
+	if c := calls[batches[0][0]]; c.method != "test_echo" || c.err != nil || c.result != `{"String":"hello","Int":1,"Args":{"S":"x"}}` {
+		t.Errorf("Unexpected echo call %+v", c)
+	}
+	if c := calls[batches[0][1]]; c.method != "test_returnError" || c.err == nil || c.result != "" {
+		t.Errorf("Unexpected failing call %+v", c)
+	}
+	var subscribed bool
+	for _, c := range calls {
+		if c.method == "nftest_subscribe" && c.err == nil && c.result != "" {
+			subscribed = true
+		}
+	}
+	if !subscribed {
+		t.Errorf("Expected subscription creation to be reported, got %+v", calls)
+	}
+}
+
+func TestRPCCallCompleteUnhandled(t *testing.T) {
+	type call struct {
+		method string
+		result string
+		err    error
+	}
+	var (
+		mu    sync.Mutex
+		calls = make(map[string]call)
+		done  = make(chan struct{}, 5)
+	)
+	old := plugins.DefaultPluginLoader
+	plugins.DefaultPluginLoader = &plugins.PluginLoader{
+		LookupCache: map[string][]interface{}{
+			"RPCCallRequest": {func(transport, remoteAddr, method string, params json.RawMessage) (json.RawMessage, json.RawMessage, error) {
+				switch method {
+				case "test_noArgsRets":
+					return nil, nil, errors.New("method not allowed")
+				case "test_returnError":
+					return nil, json.RawMessage(`"cached"`), nil
+				}
+				return nil, nil, nil
+			}},
+			"RPCCallComplete": {func(id, method string, duration time.Duration, result json.RawMessage, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				calls[id] = call{method, string(result), err}
+				done <- struct{}{}
+			}},
+		},
+	}
+	defer func() { plugins.DefaultPluginLoader = old }()
+
+	server := newTestServer()
+	defer server.Stop()
+	client := DialInProc(server)
+	defer client.Close()
+
+	client.Call(nil, "test_noArgsRets")
+	client.Call(nil, "test_returnError")
+	client.Call(nil, "test_missing")
+
+	// Messages that cannot be parsed are reported without ID nor method.
+	conn, peer := net.Pipe()
+	defer conn.Close()
+	go server.ServeCodec(NewCodec(peer), 0)
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	go io.Copy(io.Discard, conn)
+	if _, err := conn.Write([]byte(`{"jsonrpc":}`)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for completed calls, got %+v", calls)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 4 {
+		t.Fatalf("Unexpected calls %+v", calls)
+	}
+	for id, c := range calls {
+		switch c.method {
+		case "test_noArgsRets":
+			if c.err == nil || c.err.Error() != "method not allowed" {
+				t.Errorf("Unexpected rejected call %+v", c)
+			}
+		case "test_returnError":
+			if c.err != nil || c.result != `"cached"` {
+				t.Errorf("Unexpected answered call %+v", c)
+			}
+		case "test_missing":
+			if _, ok := c.err.(*jsonError); !ok || c.err.(*jsonError).Code != -32601 {
+				t.Errorf("Unexpected unknown method call %+v", c)
+			}
+		case "":
+			if id != "" || c.err == nil {
+				t.Errorf("Unexpected unparsed message %+v", c)
+			}
+		default:
+			t.Errorf("Unexpected call %q %+v", id, c)
+		}
+	}
+}
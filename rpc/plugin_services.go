@@ -0,0 +1,51 @@
+package rpc
+
+import (
+	"reflect"
+)
+
+// UnregisterName removes the methods and subscriptions of receiver from the
+// service registered under name, undoing RegisterName. Methods of other
+// receivers registered under the same name are kept. This allows plugins to
+// be reloaded while the server is running.
+func (s *Server) UnregisterName(name string, receiver interface{}) {
+	s.services.unregisterName(name, receiver)
+}
+
+func (r *serviceRegistry) unregisterName(name string, rcvr interface{}) {
+	rcvrVal := reflect.ValueOf(rcvr)
+	callbacks := suitableCallbacks(rcvrVal)
+	pluginExtendedCallbacks(callbacks, rcvrVal)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	svc, ok := r.services[name]
+	if !ok {
+		return
+	}
+	for method, cb := range callbacks {
+		registered := svc.callbacks
+		if cb.isSubscribe {
+			registered = svc.subscriptions
+		}
+		if existing, ok := registered[method]; ok && existing.belongsTo(rcvrVal) {
+			delete(registered, method)
+		}
+	}
+	if len(svc.callbacks) == 0 && len(svc.subscriptions) == 0 {
+		delete(r.services, name)
+	}
+}
+
+// belongsTo reports whether the callback was registered for rcvr, as a method
+// of rcvr or as a callback provided by it.
+func (c *callback) belongsTo(rcvr reflect.Value) bool {
+	registered := c.rcvr
+	if !registered.IsValid() {
+		registered = c.owner
+	}
+	if !registered.IsValid() || registered.Type() != rcvr.Type() || !registered.Type().Comparable() {
+		return false
+	}
+	return registered.Interface() == rcvr.Interface()
+}
@@ -0,0 +1,61 @@
+package rpc
+
+import (
+	"testing"
+)
+
+type extraService struct{ n int }
+
+func (s *extraService) Extra() int { return s.n }
+
+// callbackService provides its methods as plugin callbacks.
+type callbackService struct{ n int }
+
+func (s *callbackService) PluginCallbacks() map[string]interface{} {
+	return map[string]interface{}{"extra": func() int { return s.n }}
+}
+
+func TestServerUnregisterName(t *testing.T) {
+	server := NewServer()
+	service, extra := new(testService), &extraService{1}
+	if err := server.RegisterName("test", service); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegisterName("test", extra); err != nil {
+		t.Fatal(err)
+	}
+	server.UnregisterName("test", &extraService{2})
+	if len(server.services.services["test"].callbacks) != 11 {
+		t.Fatalf("Expected methods of other receivers to be kept")
+	}
+	server.UnregisterName("test", service)
+	svc := server.services.services["test"]
+	if len(svc.callbacks) != 1 || svc.callbacks["extra"] == nil || len(svc.subscriptions) != 0 {
+		t.Fatalf("Expected only the extra method to remain, got %d callbacks", len(svc.callbacks))
+	}
+	server.UnregisterName("test", extra)
+	if _, ok := server.services.services["test"]; ok {
+		t.Errorf("Expected empty service to be removed")
+	}
+}
+
+func TestServerUnregisterCallbacks(t *testing.T) {
+	server := NewServer()
+	provider := &callbackService{1}
+	if err := server.RegisterName("a", provider); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.RegisterName("b", &extraService{1}); err != nil {
+		t.Fatal(err)
+	}
+	// Callbacks are only removed for the service that provided them
+	server.UnregisterName("a", &callbackService{2})
+	server.UnregisterName("b", provider)
+	if server.services.services["a"].callbacks["extra"] == nil || server.services.services["b"].callbacks["extra"] == nil {
+		t.Fatalf("Expected callbacks of other services to be kept")
+	}
+	server.UnregisterName("a", provider)
+	if _, ok := server.services.services["a"]; ok {
+		t.Errorf("Expected callbacks of the provider to be removed")
+	}
+}
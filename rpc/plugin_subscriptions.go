@@ -84,6 +84,7 @@ func callbackifyChanPubSub(receiver, fn reflect.Value) *callback {
 		out := fn.Call(args)
 		if !out[1].IsNil() {
 			// This amounts to: if err != nil { return nil, err }
+			cancel()
 			return []reflect.Value{reflect.Zero(subscriptionType), out[1]}
 		}
 		// Geth's provided context is done once we've returned the subscription id.
@@ -121,7 +122,23 @@ func callbackifyChanPubSub(receiver, fn reflect.Value) *callback {
 	return c
 }
 
+// pluginCallbackProvider is implemented by services whose methods are not
+// known at compile time, such as those exposed by plugins running in their
+// own process. Each value must be a function suitable as an RPC callback.
+type pluginCallbackProvider interface {
+	PluginCallbacks() map[string]interface{}
+}
+
 func pluginExtendedCallbacks(callbacks map[string]*callback, receiver reflect.Value) {
+	if provider, ok := receiver.Interface().(pluginCallbackProvider); ok {
+		delete(callbacks, "pluginCallbacks")
+		for name, fn := range provider.PluginCallbacks() {
+			if cb := newCallback(reflect.Value{}, reflect.ValueOf(fn)); cb != nil {
+				cb.owner = receiver
+				callbacks[name] = cb
+			}
+		}
+	}
 	typ := receiver.Type()
 	for m := 0; m < typ.NumMethod(); m++ {
 		method := typ.Method(m)
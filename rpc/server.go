@@ -105,7 +105,9 @@ func (s *Server) serveSingleRequest(ctx context.Context, codec ServerCodec) {
 	reqs, batch, err := codec.readBatch()
 	if err != nil {
 		if err != io.EOF {
-			codec.writeJSON(ctx, errorMessage(&invalidMessageError{"parse error"}))
+			resp := errorMessage(&invalidMessageError{"parse error"})
+			pluginRPCCallAnswered(nil, resp, 0)
+			codec.writeJSON(ctx, resp)
 		}
 		return
 	}
@@ -56,6 +56,7 @@ type callback struct {
 	hasCtx      bool           // method's first argument is a context (not included in argTypes)
 	errPos      int            // err return idx, of -1 when method cannot return error
 	isSubscribe bool           // true if this is a subscription callback
+	owner       reflect.Value  // service providing the callback, set if fn is not a method (PluGeth injection)
 }
 
 func (r *serviceRegistry) registerName(name string, rcvr interface{}) error {